@@ -0,0 +1,154 @@
+package cache
+
+// This file contains the implementation of the Adaptive Replacement Cache
+// (ARC) policy of Megiddo and Modha. The lines of a set are split between
+// two LRU lists: T1 holds the lines accessed once since they were
+// inserted, and T2 the lines accessed at least twice. Two ghost lists, B1
+// and B2, hold the addresses of the lines recently evicted from T1 and T2.
+// A miss on an address in B1 means T1 is too small, so its target size p
+// grows, and a miss on an address in B2 means T2 is too small, so p
+// shrinks. The victim comes from T1 if it is larger than p, and from T2
+// otherwise. Lines found in a ghost list are inserted into T2.
+
+// The ARCStats struct counts the misses on the ghost lists of a cache
+type ARCStats struct {
+	b1Hits uint64
+	b2Hits uint64
+}
+
+// Stats returns the ghost list hits
+func (stats *ARCStats) Stats() map[string]interface{} {
+	return map[string]interface{}{
+		"ghost_hits": stats.b1Hits + stats.b2Hits,
+		"b1_hits":    stats.b1Hits,
+		"b2_hits":    stats.b2Hits,
+	}
+}
+
+type ARC struct {
+	capacity  int
+	p         int         // The target size of T1
+	t1, t2    *orderedSet // The ways holding the lines, from MRU to LRU
+	b1, b2    *orderedSet // The addresses of the evicted lines, from MRU to LRU
+	addresses []uint64    // The address of the line held in each way
+	admitted  bool        // The incoming line has already been looked up
+	ghost     int         // The ghost list holding the incoming line, 0 if none
+	stats     *ARCStats   // The counters shared by the sets of the cache
+}
+
+func NewARC(capacity int, stats *ARCStats) *ARC {
+	return &ARC{
+		capacity:  capacity,
+		t1:        newOrderedSet(),
+		t2:        newOrderedSet(),
+		b1:        newOrderedSet(),
+		b2:        newOrderedSet(),
+		addresses: make([]uint64, capacity),
+		stats:     stats,
+	}
+}
+
+// Insert adds the line to T2 if its address was in a ghost list, and to
+// T1 otherwise
+func (arc *ARC) Insert(line *CacheLine, access Access) {
+	if !arc.admitted {
+		arc.admit(access.Address)
+	}
+
+	arc.addresses[line.Index] = access.Address
+	if arc.ghost != 0 {
+		arc.t2.pushFront(uint64(line.Index))
+	} else {
+		arc.t1.pushFront(uint64(line.Index))
+	}
+	arc.admitted = false
+	arc.ghost = 0
+}
+
+// Update moves a line that hit to the MRU position of T2
+func (arc *ARC) Update(line *CacheLine, access Access) {
+	way := uint64(line.Index)
+	if arc.t1.remove(way) || arc.t2.remove(way) {
+		arc.t2.pushFront(way)
+	}
+}
+
+// Evict returns the LRU line of T1 or T2, depending on the target size
+// of T1, and remembers its address in the matching ghost list
+func (arc *ARC) Evict(access Access) int {
+	arc.admit(access.Address)
+
+	// When T1 and B1 fill the whole set with lines seen only once, the
+	// LRU line of T1 is dropped without being remembered
+	if arc.ghost == 0 && arc.t1.len() == arc.capacity {
+		way, _ := arc.t1.popBack()
+		return int(way)
+	}
+
+	t1 := arc.t1.len()
+	if t1 > 0 && (t1 > arc.p || (arc.ghost == 2 && t1 == arc.p) || arc.t2.len() == 0) {
+		way, _ := arc.t1.popBack()
+		arc.b1.pushFront(arc.addresses[way])
+		return int(way)
+	}
+
+	// Both lists are only empty if the lines of the set were filled
+	// without the policy, in which case the first way is evicted
+	way, ok := arc.t2.popBack()
+	if !ok {
+		return 0
+	}
+	arc.b2.pushFront(arc.addresses[way])
+	return int(way)
+}
+
+// Remove forgets an invalidated line
+func (arc *ARC) Remove(line *CacheLine) {
+	way := uint64(line.Index)
+	if !arc.t1.remove(way) {
+		arc.t2.remove(way)
+	}
+}
+
+// admit looks up the address of an incoming line in the ghost lists,
+// adapting the target size of T1 on a ghost hit, and trims the ghost
+// lists so that the set remembers at most twice its capacity
+func (arc *ARC) admit(address uint64) {
+	arc.admitted = true
+	switch {
+	case arc.b1.contains(address):
+		arc.stats.b1Hits++
+		delta := 1
+		if arc.b2.len() > arc.b1.len() {
+			delta = arc.b2.len() / arc.b1.len()
+		}
+		arc.p += delta
+		if arc.p > arc.capacity {
+			arc.p = arc.capacity
+		}
+		arc.b1.remove(address)
+		arc.ghost = 1
+	case arc.b2.contains(address):
+		arc.stats.b2Hits++
+		delta := 1
+		if arc.b1.len() > arc.b2.len() {
+			delta = arc.b1.len() / arc.b2.len()
+		}
+		arc.p -= delta
+		if arc.p < 0 {
+			arc.p = 0
+		}
+		arc.b2.remove(address)
+		arc.ghost = 2
+	default:
+		l1 := arc.t1.len() + arc.b1.len()
+		total := l1 + arc.t2.len() + arc.b2.len()
+		if l1 >= arc.capacity {
+			if arc.t1.len() < arc.capacity {
+				arc.b1.popBack()
+			}
+		} else if total >= 2*arc.capacity {
+			arc.b2.popBack()
+		}
+	}
+}
@@ -12,30 +12,88 @@ import (
 	"encoding/json"
 	"fmt"
 	"math"
+	"math/rand"
+	"strconv"
+	"strings"
 
 	"github.com/nsengupta5/Cache-Simulator/utils"
 )
 
-// The addresss size for ths practical is 64 bits
-const addressSize int = 64
+// The default address size is 64 bits, it can be reduced with the
+// address_bits field of the configuration for 32-bit and 48-bit traces
+const DefaultAddressBits int = 64
+
+// The default seed of the generator of the policies making random choices.
+// A seed of 0 in the configuration selects it.
+const DefaultSeed int64 = 1
+
+// The inclusion policies between the levels of the hierarchy. In an
+// inclusive hierarchy, every line of a level is also held by the levels
+// below it, so evicting a line from a lower level back-invalidates it in
+// the levels above. In an exclusive hierarchy, a line is held by at most
+// one level: victims move down a level and hits in lower levels move the
+// line up to the first level. A non-inclusive, non-exclusive (NINE)
+// hierarchy fills every level that misses and never back-invalidates.
+const (
+	Inclusive string = "inclusive"
+	Exclusive string = "exclusive"
+	NINE      string = "nine"
+)
+
+// The write policies a cache can use. Write-back caches mark lines as
+// dirty and only write them to the next level when they are evicted,
+// whereas write-through caches forward every write to the next level.
+const (
+	WriteBack    string = "write-back"
+	WriteThrough string = "write-through"
+)
+
+// The write miss policies a cache can use. Write-allocate caches fetch
+// the line on a write miss, whereas no-write-allocate caches forward the
+// write to the next level without filling the line.
+const (
+	WriteAllocate   string = "write-allocate"
+	NoWriteAllocate string = "no-write-allocate"
+)
 
 // The ReplacementPolicy interface is a contract for implementing
 // different replacement policies for the cache
 type ReplacementPolicy interface {
-	Insert(line *CacheLine) // Insert inserts a line into the cache
+	Insert(line *CacheLine, access Access) // Insert inserts a line into the cache
+
+	Update(line *CacheLine, access Access) // Update updates the state of a line in the cache.
 
-	Update(line *CacheLine) // Update updates the state of a line in the cache.
+	Evict(access Access) int // Evict returns the index of the line to evict
+
+	Remove(line *CacheLine) // Remove forgets a line that has been invalidated
+}
 
-	Evict() int // Evict returns the index of the line to evict
+// The PolicyStats interface is implemented by the state shared by the
+// replacement policies of a cache which reports its own statistics
+type PolicyStats interface {
+	Stats() map[string]interface{}
+}
+
+// The Access struct describes the access for which a replacement
+// policy is invoked
+type Access struct {
+	Time    uint64 // The position of the access in the trace, starting at 1
+	Address uint64 // The address of the first byte of the accessed line
+	PC      uint64 // The program counter of the instruction making the access
 }
 
 // The CacheLine struct represents a line in the cache
 type CacheLine struct {
-	Valid      bool       `json:"valid"`
-	Tag        int        `json:"tag"`
-	Freq       int        `json:"frequency"`
-	Index      int        `json:"index"`
-	Prev, Next *CacheLine `json:"-"`
+	Valid      bool           `json:"valid"`
+	Dirty      bool           `json:"dirty"`
+	Prefetched bool           `json:"prefetched"` // Brought in by a prefetch and not used yet
+	ReadyAt    uint64         `json:"ready_at"`   // The instruction at which a prefetch completes
+	Tag        uint64         `json:"tag"`
+	Freq       int            `json:"frequency"`
+	Index      int            `json:"index"`
+	Owner      int            `json:"owner"` // The core that brought the line into a shared cache
+	State      CoherenceState `json:"state"` // The coherence state of a line of a private cache
+	Prev, Next *CacheLine     `json:"-"`
 }
 
 // The CacheSet struct represents a set in the cache
@@ -47,98 +105,229 @@ type CacheSet struct {
 
 // The Cache struct represents a cache
 type Cache struct {
-	Sets       []CacheSet `json:"sets"`
-	Name       string     `json:"name"`
-	Size       int        `json:"size"`
-	PolicyName string     `json:"replacement_policy"`
-	Kind       string     `json:"kind"`
-	LineSize   int        `json:"line_size"`
-	TagSize    int        `json:"tag_size"`
-	IndexSize  int        `json:"index_size"`
-	OffsetSize int        `json:"offset_size"`
-	Hits       int        `json:"hits"`
-	Misses     int        `json:"misses"`
+	Sets               []CacheSet         `json:"sets"`
+	Name               string             `json:"name"`
+	Size               int                `json:"size"`
+	PolicyName         string             `json:"replacement_policy"`
+	PolicyParams       PolicyParams       `json:"policy_params"`
+	Seed               int64              `json:"seed"`
+	PolicyState        PolicyStats        `json:"-"`
+	Kind               string             `json:"kind"`
+	Associativity      int                `json:"associativity"`
+	LineSize           int                `json:"line_size"`
+	NextLevel          string             `json:"next_level"`
+	Serves             string             `json:"serves"`
+	Private            bool               `json:"private"`
+	Core               int                `json:"-"` // The core owning a private cache
+	Next               int                `json:"-"` // The index of the next level, the number of caches for main memory
+	WritePolicy        string             `json:"write_policy"`
+	WriteMissPolicy    string             `json:"write_miss_policy"`
+	PrefetcherConfig   *PrefetcherConfig  `json:"prefetcher"`
+	Prefetcher         Prefetcher         `json:"-"`
+	VictimConfig       *VictimCacheConfig `json:"victim_cache"`
+	Victim             *Cache             `json:"-"`
+	Classifier         *MissClassifier    `json:"-"`
+	Oracle             *Oracle            `json:"-"`
+	TagSize            int                `json:"tag_size"`
+	IndexSize          int                `json:"index_size"`
+	OffsetSize         int                `json:"offset_size"`
+	Hits               int                `json:"hits"`
+	Misses             int                `json:"misses"`
+	Reads              int                `json:"reads"`
+	Writes             int                `json:"writes"`
+	DirtyEvictions     int                `json:"dirty_evictions"`
+	BackInvalidations  int                `json:"back_invalidations"`
+	PrefetchesIssued   int                `json:"prefetches_issued"`
+	UsefulPrefetches   int                `json:"useful_prefetches"`
+	LatePrefetches     int                `json:"late_prefetches"`
+	UselessPrefetches  int                `json:"useless_prefetches"`
+	PollutionEvictions int                `json:"pollution_evictions"`
+	PrefetchHits       int                `json:"prefetch_hits"`   // The fills of lines prefetched by the levels above that hit
+	PrefetchMisses     int                `json:"prefetch_misses"` // The fills of lines prefetched by the levels above that missed
+	VictimHits         int                `json:"victim_hits"`
+	VictimSwaps        int                `json:"victim_swaps"`
+	InterCoreEvictions int                `json:"inter_core_evictions"`
+	SharedStats        []SharedCoreStats  `json:"-"` // The accesses of each core to a shared cache
 }
 
 // The CacheConfig struct represents the configuration of
 // the cache
 type CacheConfig struct {
-	Caches         []Cache `json:"caches"`
-	MemoryAccesses int     `json:"memory_accesses"`
+	Caches           []Cache           `json:"caches"`
+	AddressBits      int               `json:"address_bits"`
+	Inclusion        string            `json:"inclusion"`
+	ClassifyMisses   bool              `json:"classify_misses"`
+	MemoryAccesses   int               `json:"memory_accesses"`
+	MemoryBytes      int               `json:"memory_bytes"`
+	MemoryWrites     int               `json:"memory_writes"`
+	MemoryWritebacks int               `json:"memory_writebacks"`
+	MemoryWriteBytes int               `json:"memory_write_bytes"`
+	Cores            int               `json:"cores"`
+	Interleave       string            `json:"interleave"`
+	CoreStats        []CoreStats       `json:"-"`
+	Coherence        string            `json:"coherence"`
+	Protocol         CoherenceProtocol `json:"-"`
+	CoherenceStats   []CoherenceStats  `json:"-"`
+	DirectoryConfig  *DirectoryConfig  `json:"directory"`
+	Directory        *Directory        `json:"-"`
+
+	instructionLevels []int   // The first-level cache serving the instruction fetches of each core
+	dataLevels        []int   // The first-level cache serving the data accesses of each core
+	above             [][]int // The caches whose misses go through each cache
+	private           [][]int // The private caches of each core, when kept coherent
+	others            [][]int // The cores other than each core, which snoop its transactions
 }
 
 /* ------------------- Cache Function ------------------- */
 
-// SetLiesSize sets the number of lines in each set
-// It checks the kind of cache and sets the number of lines accordingly
-func (cache *Cache) SetLinesSize() {
+// SetAssociativity sets the number of lines in each set
+// If the associativity isn't given explicitly, it is worked out from the
+// kind of cache, which is either "direct", "full" or "Nway" for any N
+func (cache *Cache) SetAssociativity() {
 	cacheLines := cache.Size / cache.LineSize
+	ways, err := ParseKind(cache.Kind, cacheLines)
+	utils.Check(err)
+
+	if cache.Associativity == 0 {
+		cache.Associativity = ways
+	}
+}
+
+// ParseKind returns the associativity described by the kind of a cache
+// with the given number of lines. An empty kind returns 0, meaning the
+// associativity has to be given explicitly.
+func ParseKind(kind string, cacheLines int) (int, error) {
+	switch kind {
+	case "":
+		return 0, nil
+	case "direct":
+		return 1, nil
+	case "full":
+		return cacheLines, nil
+	}
+
+	ways, err := strconv.Atoi(strings.TrimSuffix(kind, "way"))
+	if !strings.HasSuffix(kind, "way") || err != nil || ways <= 0 {
+		return 0, fmt.Errorf(
+			"unknown cache kind %q, expected \"direct\", \"full\" or \"Nway\"", kind,
+		)
+	}
+	return ways, nil
+}
+
+// SetLinesSize sets the number of lines in each set
+// Every set holds as many lines as the associativity of the cache
+func (cache *Cache) SetLinesSize() {
 	for i := range cache.Sets {
 		set := &cache.Sets[i]
-		switch cache.Kind {
-		case "direct":
-			set.Lines = make([]CacheLine, 1)
-		case "full":
-			set.Lines = make([]CacheLine, cacheLines)
-		case "2way":
-			set.Lines = make([]CacheLine, 2)
-		case "4way":
-			set.Lines = make([]CacheLine, 4)
-		default:
-			set.Lines = make([]CacheLine, 8)
-		}
+		set.Lines = make([]CacheLine, cache.Associativity)
 	}
 }
 
 // SetSetsSize sets the number of sets in the cache
-// It checks the kind of cache and sets the number of sets accordingly
+// The number of sets is the number of lines divided by the associativity
 func (cache *Cache) SetSetsSize() {
 	cacheLines := cache.Size / cache.LineSize
-	var setSize int
-	switch cache.Kind {
-	case "direct":
-		setSize = cacheLines
-		cache.Sets = make([]CacheSet, setSize)
-	case "full":
-		cache.Sets = make([]CacheSet, 1)
-	case "2way":
-		setSize = cacheLines / 2
-		cache.Sets = make([]CacheSet, setSize)
-	case "4way":
-		setSize = cacheLines / 4
-		cache.Sets = make([]CacheSet, setSize)
-	default:
-		setSize = cacheLines / 8
-		cache.Sets = make([]CacheSet, setSize)
-	}
+	setSize := cacheLines / cache.Associativity
+	cache.Sets = make([]CacheSet, setSize)
+}
+
+// IsDirectMapped returns true if every set holds a single line
+func (cache *Cache) IsDirectMapped() bool {
+	return cache.Associativity == 1
 }
 
-// SetDefaultPolicy sets the default replacement policy for the cache
+// SetDefaultPolicy creates the replacement policy of every set of the
+// cache from the policy registered under the name of its policy
 func (cache *Cache) SetDefaultPolicy() {
-	if cache.Kind != "direct" && cache.PolicyName == "" {
+	if !cache.IsDirectMapped() && cache.PolicyName == "" {
 		// Default policy for set associative caches is round robin
 		cache.PolicyName = "rr"
 	}
 
+	// Direct mapped caches have a single way, so the policy doesn't
+	// matter if none is configured
+	name := cache.PolicyName
+	if name == "" {
+		name = "rr"
+	}
+	policy, ok := policies[name]
+	if !ok {
+		utils.Check(fmt.Errorf("cache %s: unknown replacement policy %q", cache.Name, name))
+	}
+
+	// The policies making random choices share a generator seeded with
+	// the seed of the cache, so that runs are reproducible
+	cache.SetSeed()
+	rng := rand.New(rand.NewSource(cache.Seed))
+
+	newSetPolicy := policy.factory(cache, rng)
 	for s := range cache.Sets {
 		set := &cache.Sets[s]
-		capacity := len(set.Lines)
-		switch cache.PolicyName {
-		case "lru":
-			set.Policy = NewLRU(capacity)
-		case "lfu":
-			set.Policy = NewLFU(capacity)
-		default:
-			set.Policy = NewRR(capacity)
-		}
+		set.Policy = newSetPolicy(s, len(set.Lines))
+	}
+}
+
+// SetSeed sets the default seed of the cache if none is configured
+func (cache *Cache) SetSeed() {
+	if cache.Seed == 0 {
+		cache.Seed = DefaultSeed
+	}
+}
+
+// SetWritePolicies sets the default write policies for the cache
+// Caches are write-back and write-allocate unless configured otherwise
+func (cache *Cache) SetWritePolicies() {
+	if cache.WritePolicy == "" {
+		cache.WritePolicy = WriteBack
+	}
+	if cache.WriteMissPolicy == "" {
+		cache.WriteMissPolicy = WriteAllocate
+	}
+}
+
+// IsWriteThrough returns true if the cache forwards every write
+// to the next level
+func (cache *Cache) IsWriteThrough() bool {
+	return cache.WritePolicy == WriteThrough
+}
+
+// IsWriteAllocate returns true if the cache fills the line on a write miss
+func (cache *Cache) IsWriteAllocate() bool {
+	return cache.WriteMissPolicy != NoWriteAllocate
+}
+
+// SetPrefetcher creates the prefetcher of the cache, if one is configured
+func (cache *Cache) SetPrefetcher() {
+	if cache.PrefetcherConfig == nil {
+		return
 	}
+
+	prefetcher, err := NewPrefetcher(*cache.PrefetcherConfig, cache.LineSize)
+	utils.Check(err)
+	cache.Prefetcher = prefetcher
+}
+
+// SetVictimCache creates the victim cache of the cache, if one is configured
+func (cache *Cache) SetVictimCache(addressBits int) {
+	if cache.VictimConfig == nil {
+		return
+	}
+	cache.Victim = NewVictimCache(*cache.VictimConfig, cache.Name, cache.LineSize, cache.Seed, addressBits)
+}
+
+// SetMissClassifier enables the classification of the misses of the cache
+// into compulsory, capacity and conflict misses
+func (cache *Cache) SetMissClassifier() {
+	cache.Classifier = NewMissClassifier(cache.Size / cache.LineSize)
 }
 
 // SetBitsSize sets the number of bits for offset, index and tag
-func (cache *Cache) SetBitsSize() {
+// for addresses of the given size
+func (cache *Cache) SetBitsSize(addressBits int) {
 	cache.OffsetSize = cache.getOffsetBits()
 	cache.IndexSize = cache.getIndexBits()
-	cache.TagSize = cache.getTagBits()
+	cache.TagSize = cache.getTagBits(addressBits)
 }
 
 // getOffsetBits returns the number of bits for the offset
@@ -148,42 +337,24 @@ func (cache *Cache) getOffsetBits() int {
 }
 
 // getIndexBits returns the number of bits for the index
-// The number of bits is dependent on the kind of cache
+// The number of bits is dependent on the number of sets, so a fully
+// associative cache has no index bits
 func (cache *Cache) getIndexBits() int {
-	var setSize int
-	switch cache.Kind {
-	case "direct":
-		setSize = cache.Size / cache.LineSize
-		return int(math.Log2(float64(setSize)))
-	case "full":
-		return 0
-	case "2way", "4way", "8way":
-		setSize = int(len(cache.Sets))
-		return int(math.Log2(float64(setSize)))
-	default:
-		return 0
-	}
+	setSize := len(cache.Sets)
+	return int(math.Log2(float64(setSize)))
 }
 
 // getTagBits returns the number of bits for the tag
-// The number of bits is dependent on the kind of cache
-func (cache *Cache) getTagBits() int {
-	var tagBits int
-	switch cache.Kind {
-	// The tag is the remaining bits before the offset and index bits
-	case "full":
-		tagBits = addressSize - cache.OffsetSize
-	default:
-		tagBits = addressSize - cache.OffsetSize - cache.IndexSize
-	}
-	return tagBits
+// The tag is the remaining bits before the offset and index bits
+func (cache *Cache) getTagBits(addressBits int) int {
+	return addressBits - cache.OffsetSize - cache.IndexSize
 }
 
 // CheckHitOrMiss checks if the address is in the cache
 // It identifies the set from the index and looks for the tag in the set
 
 // It returns a boolean indicating if the address is in the cache and the cache line
-func (cache *Cache) CheckHitOrMiss(tag int, index int) (bool, *CacheLine) {
+func (cache *Cache) CheckHitOrMiss(tag uint64, index uint64) (bool, *CacheLine) {
 	set := cache.Sets[index]
 
 	for i := range set.Lines {
@@ -197,20 +368,131 @@ func (cache *Cache) CheckHitOrMiss(tag int, index int) (bool, *CacheLine) {
 	return false, nil
 }
 
+// IsSetFull returns true if every line of the set with the given index
+// is valid, so that inserting a new line evicts one
+func (cache *Cache) IsSetFull(index uint64) bool {
+	for _, line := range cache.Sets[index].Lines {
+		if !line.Valid {
+			return false
+		}
+	}
+	return true
+}
+
+// Invalidate removes the line with the given tag from the set with the
+// given index. It returns the invalidated line and a boolean indicating
+// if the line was present in the cache.
+func (cache *Cache) Invalidate(tag uint64, index uint64) (CacheLine, bool) {
+	set := &cache.Sets[index]
+	for i := range set.Lines {
+		line := set.Lines[i]
+		if line.Tag == tag && line.Valid {
+			set.Invalidate(i)
+			return line, true
+		}
+	}
+	return CacheLine{}, false
+}
+
+// GetMemoryInfo extracts the index, tag and offset of the given address
+// for this cache
+func (cache *Cache) GetMemoryInfo(address uint64) (uint64, uint64, uint64) {
+	return utils.DecodeAddress(address, cache.IndexSize, cache.OffsetSize)
+}
+
+// GetLineAddress returns the address of the first byte of the line
+// holding the given address
+func (cache *Cache) GetLineAddress(address uint64) uint64 {
+	return address &^ uint64(cache.LineSize-1)
+}
+
+// GetAddress rebuilds the address of the first byte of the line with
+// the given tag in the set with the given index
+func (cache *Cache) GetAddress(tag uint64, index uint64) uint64 {
+	return utils.EncodeAddress(tag, index, cache.IndexSize, cache.OffsetSize)
+}
+
+// HitRate returns the fraction of the accesses to the cache that hit
+func (cache *Cache) HitRate() float64 {
+	accesses := cache.Hits + cache.Misses
+	if accesses == 0 {
+		return 0
+	}
+	return float64(cache.Hits) / float64(accesses)
+}
+
 // GetStats returns the cache statistics
 func (cache *Cache) GetStats() map[string]interface{} {
-	return map[string]interface{}{
-		"hits":   cache.Hits,
-		"misses": cache.Misses,
-		"name":   cache.Name,
+	stats := map[string]interface{}{
+		"hits":               cache.Hits,
+		"misses":             cache.Misses,
+		"name":               cache.Name,
+		"reads":              cache.Reads,
+		"writes":             cache.Writes,
+		"dirty_evictions":    cache.DirtyEvictions,
+		"back_invalidations": cache.BackInvalidations,
+	}
+
+	if cache.PolicyState != nil {
+		stats["policy"] = cache.PolicyState.Stats()
 	}
+
+	if cache.Classifier != nil {
+		stats["compulsory_misses"] = cache.Classifier.Compulsory
+		stats["capacity_misses"] = cache.Classifier.Capacity
+		stats["conflict_misses"] = cache.Classifier.Conflict
+	}
+
+	if cache.Victim != nil {
+		stats["victim_hits"] = cache.VictimHits
+		stats["victim_swaps"] = cache.VictimSwaps
+	}
+
+	// A cache shared by several cores also reports the accesses of each
+	// core, and the lines each core lost to the others
+	if cache.SharedStats != nil {
+		coreStats := []map[string]interface{}{}
+		for core, counts := range cache.SharedStats {
+			coreStats = append(coreStats, map[string]interface{}{
+				"core":                   core,
+				"hits":                   counts.Hits,
+				"misses":                 counts.Misses,
+				"evicted_by_other_cores": counts.InterCoreEvictions,
+			})
+		}
+		stats["cores"] = coreStats
+		stats["inter_core_evictions"] = cache.InterCoreEvictions
+	}
+
+	// A cache below a prefetcher reports the prefetch fills it served
+	// apart from the demand accesses
+	if cache.PrefetchHits+cache.PrefetchMisses > 0 {
+		stats["prefetch_fills"] = map[string]interface{}{
+			"hits":   cache.PrefetchHits,
+			"misses": cache.PrefetchMisses,
+		}
+	}
+
+	if cache.Prefetcher != nil {
+		stats["prefetcher"] = map[string]interface{}{
+			"kind":                cache.PrefetcherConfig.Kind,
+			"prefetches_issued":   cache.PrefetchesIssued,
+			"useful_prefetches":   cache.UsefulPrefetches,
+			"late_prefetches":     cache.LatePrefetches,
+			"useless_prefetches":  cache.UselessPrefetches,
+			"pollution_evictions": cache.PollutionEvictions,
+		}
+	}
+	return stats
 }
 
 /* ------------------- Cache Set Function ------------------- */
 
 // Insert adds a new line to the set
 // This function is exclusive to the set associative caches
-func (set *CacheSet) Insert(newLine *CacheLine) {
+// It returns the evicted line and a boolean indicating if a valid
+// line had to be evicted to make room for the new line
+func (set *CacheSet) Insert(newLine *CacheLine, access Access) (CacheLine, bool) {
 	for i := range set.Lines {
 		line := &set.Lines[i]
 		if !line.Valid {
@@ -218,21 +500,58 @@ func (set *CacheSet) Insert(newLine *CacheLine) {
 			newLine.Index = i
 
 			// Update the policy with the new line
-			set.Policy.Insert(newLine)
+			set.Policy.Insert(newLine, access)
 			set.Lines[i] = *newLine
-			return
+			return CacheLine{}, false
 		}
 	}
 
 	// If the set is full, evict a line and insert the new line
-	evictIndex := set.Policy.Evict()
+	evictIndex := set.Policy.Evict(access)
+	evicted := set.Lines[evictIndex]
 	newLine.Index = evictIndex
-	set.Policy.Insert(newLine)
+	set.Policy.Insert(newLine, access)
 	set.Lines[evictIndex] = *newLine
+	return evicted, true
+}
+
+// Invalidate marks the line at the given position of the set as invalid
+// and removes it from the replacement policy
+func (set *CacheSet) Invalidate(i int) {
+	line := &set.Lines[i]
+	set.Policy.Remove(line)
+	line.Valid = false
+	line.Dirty = false
 }
 
 /* ------------------- Cache Config Function ------------------- */
 
+// SetInclusion sets the default inclusion policy of the hierarchy
+// Hierarchies are non-inclusive, non-exclusive unless configured otherwise
+func (config *CacheConfig) SetInclusion() {
+	if config.Inclusion == "" {
+		config.Inclusion = NINE
+	}
+}
+
+// IsInclusive returns true if every line of a level is also held by
+// the levels below it
+func (config *CacheConfig) IsInclusive() bool {
+	return config.Inclusion == Inclusive
+}
+
+// IsExclusive returns true if every line is held by at most one level
+func (config *CacheConfig) IsExclusive() bool {
+	return config.Inclusion == Exclusive
+}
+
+// AddressMask returns the mask selecting the bits of an address that are
+// part of the address space. The addresses of a trace can't have any
+// higher bits set.
+func (config *CacheConfig) AddressMask() uint64 {
+	return ^uint64(0) >> (64 - config.AddressBits)
+}
+
 // PrintStats prints the cache statistics
 func (config *CacheConfig) PrintStats() {
 	cacheStats := []map[string]interface{}{}
@@ -243,10 +562,35 @@ func (config *CacheConfig) PrintStats() {
 	}
 
 	stats := map[string]interface{}{
-		"caches":               cacheStats,
-		"main_memory_accesses": config.MemoryAccesses,
+		"caches":                  cacheStats,
+		"main_memory_accesses":    config.MemoryAccesses,
+		"main_memory_bytes":       config.MemoryBytes,
+		"main_memory_writes":      config.MemoryWrites,
+		"main_memory_writebacks":  config.MemoryWritebacks,
+		"main_memory_write_bytes": config.MemoryWriteBytes,
+	}
+
+	// A hierarchy with split first-level caches also reports the caches
+	// each kind of access goes through
+	if config.IsSplit() {
+		stats["branches"] = config.Branches()
+	}
+
+	// A multi-core hierarchy also reports the accesses of each core
+	if config.IsMultiCore() {
+		stats["cores"] = config.coreStats()
 	}
 
+	// A directory reports its occupancy and traffic
+	if config.Directory != nil {
+		stats["directory"] = config.Directory.Stats()
+	}
+
+	PrintJSON(stats)
+}
+
+// PrintJSON prints the given statistics as indented JSON
+func PrintJSON(stats interface{}) {
 	output, err := json.MarshalIndent(stats, "", "  ")
 	utils.Check(err)
 	fmt.Println(string(output))
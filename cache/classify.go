@@ -0,0 +1,69 @@
+package cache
+
+// This file contains the classification of cache misses into the three
+// Cs: compulsory, capacity and conflict misses. A miss is compulsory if
+// the line has never been accessed before. Otherwise, it is a capacity
+// miss if the line would also have missed in a fully associative LRU
+// cache with the same number of lines, and a conflict miss if it would
+// have hit, meaning the miss is caused by the mapping of lines to sets.
+// The fully associative cache is simulated alongside the real cache with
+// the LRU policy, using the line addresses as tags. Only demand accesses
+// are classified, the fills of prefetched lines are left out.
+//
+// Telling compulsory misses apart requires remembering every line ever
+// accessed, so the memory used by a classifier isn't bounded by the size
+// of its cache but grows with the footprint of the trace, by one map entry
+// per distinct line.
+
+// The MissClassifier struct classifies the misses of a cache
+type MissClassifier struct {
+	seen       map[uint64]bool // The lines that have been accessed, growing with the footprint of the trace
+	shadow     *LRU            // The fully associative LRU cache
+	Compulsory int
+	Capacity   int
+	Conflict   int
+}
+
+func NewMissClassifier(cacheLines int) *MissClassifier {
+	return &MissClassifier{
+		seen:   make(map[uint64]bool),
+		shadow: NewLRU(cacheLines),
+	}
+}
+
+// Access records a demand access to the line at the given address and
+// classifies it if it missed in the real cache
+func (mc *MissClassifier) Access(lineAddress uint64, hit bool) {
+	shadowHit := mc.accessShadow(lineAddress)
+	seen := mc.seen[lineAddress]
+	mc.seen[lineAddress] = true
+
+	if hit {
+		return
+	}
+
+	switch {
+	case !seen:
+		mc.Compulsory++
+	case !shadowHit:
+		mc.Capacity++
+	default:
+		mc.Conflict++
+	}
+}
+
+// accessShadow accesses the line in the fully associative LRU cache
+// It returns a boolean indicating if the line was present
+func (mc *MissClassifier) accessShadow(lineAddress uint64) bool {
+	line := &CacheLine{Tag: lineAddress, Valid: true}
+	if _, exists := mc.shadow.cache[lineAddress]; exists {
+		mc.shadow.Update(line, Access{})
+		return true
+	}
+
+	if len(mc.shadow.cache) == mc.shadow.capacity {
+		mc.shadow.Evict(Access{})
+	}
+	mc.shadow.Insert(line, Access{})
+	return false
+}
@@ -0,0 +1,145 @@
+package cache
+
+// This file contains the implementation of the CLOCK and not recently
+// used (NRU) replacement policies, two cheap approximations of LRU with
+// one reference bit per way. Both set the bit of a way when its line is
+// inserted or hit, and only differ in how they clear the bits.
+//   - CLOCK (second chance) keeps a hand pointing at a way of the set. To
+//     find a victim, the hand moves over the ways, clearing the reference
+//     bits that are set, until it finds a way whose bit is clear. The hand
+//     then points to the way after the victim.
+//   - NRU evicts the first way whose bit is clear. If every bit is set,
+//     all the bits of the set are cleared at once before the victim is
+//     chosen.
+// The sets of a cache share counters of the work done on the bits, which
+// give an idea of the cost of the policies in hardware.
+
+/* ------------------- CLOCK ------------------- */
+
+// The ClockStats struct counts the moves of the hands of a cache
+type ClockStats struct {
+	advances      uint64 // The ways the hands moved past
+	secondChances uint64 // The reference bits cleared by the hands
+	sweeps        uint64 // The full revolutions of the hands
+}
+
+// Stats returns the counters of the hands
+func (stats *ClockStats) Stats() map[string]interface{} {
+	return map[string]interface{}{
+		"hand_advances":  stats.advances,
+		"second_chances": stats.secondChances,
+		"hand_sweeps":    stats.sweeps,
+	}
+}
+
+type Clock struct {
+	capacity   int
+	referenced bitVector
+	hand       int
+	stats      *ClockStats // The counters shared by the sets of the cache
+}
+
+func NewClock(capacity int, stats *ClockStats) *Clock {
+	return &Clock{
+		capacity:   capacity,
+		referenced: newBitVector(capacity),
+		stats:      stats,
+	}
+}
+
+// Insert marks the inserted line as referenced
+func (clock *Clock) Insert(line *CacheLine, access Access) {
+	clock.referenced.set(line.Index, true)
+}
+
+// Update marks the accessed line as referenced
+func (clock *Clock) Update(line *CacheLine, access Access) {
+	clock.referenced.set(line.Index, true)
+}
+
+// Evict moves the hand until it finds a line that wasn't referenced,
+// giving a second chance to the referenced lines it passes
+func (clock *Clock) Evict(access Access) int {
+	for clock.referenced.get(clock.hand) {
+		clock.referenced.set(clock.hand, false)
+		clock.stats.secondChances++
+		clock.advance()
+	}
+	evictIndex := clock.hand
+	clock.advance()
+	return evictIndex
+}
+
+// Remove clears the reference bit of an invalidated line
+func (clock *Clock) Remove(line *CacheLine) {
+	clock.referenced.set(line.Index, false)
+}
+
+// advance moves the hand to the next way
+func (clock *Clock) advance() {
+	clock.stats.advances++
+	clock.hand++
+	if clock.hand == clock.capacity {
+		clock.hand = 0
+		clock.stats.sweeps++
+	}
+}
+
+/* ------------------- NRU ------------------- */
+
+// The NRUStats struct counts the bulk resets of the bits of a cache
+type NRUStats struct {
+	resets uint64 // The times every bit of a set was cleared
+}
+
+// Stats returns the counters of the resets
+func (stats *NRUStats) Stats() map[string]interface{} {
+	return map[string]interface{}{
+		"resets": stats.resets,
+	}
+}
+
+type NRU struct {
+	capacity   int
+	referenced bitVector
+	stats      *NRUStats // The counters shared by the sets of the cache
+}
+
+func NewNRU(capacity int, stats *NRUStats) *NRU {
+	return &NRU{
+		capacity:   capacity,
+		referenced: newBitVector(capacity),
+		stats:      stats,
+	}
+}
+
+// Insert marks the inserted line as recently used
+func (nru *NRU) Insert(line *CacheLine, access Access) {
+	nru.referenced.set(line.Index, true)
+}
+
+// Update marks the accessed line as recently used
+func (nru *NRU) Update(line *CacheLine, access Access) {
+	nru.referenced.set(line.Index, true)
+}
+
+// Evict returns the first way that wasn't recently used, clearing every
+// bit of the set if all of them are set
+func (nru *NRU) Evict(access Access) int {
+	for i := 0; i < nru.capacity; i++ {
+		if !nru.referenced.get(i) {
+			return i
+		}
+	}
+
+	for i := 0; i < nru.capacity; i++ {
+		nru.referenced.set(i, false)
+	}
+	nru.stats.resets++
+	return 0
+}
+
+// Remove clears the bit of an invalidated line
+func (nru *NRU) Remove(line *CacheLine) {
+	nru.referenced.set(line.Index, false)
+}
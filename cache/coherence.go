@@ -0,0 +1,440 @@
+package cache
+
+// This file contains the coherence protocols keeping the private caches of
+// the cores coherent, modeled with a snooping bus. The private caches of a
+// core act as a single node on the bus: every copy of a line in them has
+// the same coherence state, and a core that doesn't hold a line in any of
+// its private caches holds it in the invalid state. An access that the
+// state of the line doesn't allow is broadcast on the bus, and every other
+// core holding the line snoops it and moves the line to a new state, unless
+// a sparse directory restricts the transaction to the sharers it records.
+//
+// The protocols only decide the transitions between the states, through
+// the CoherenceProtocol interface, so that the simulator works with any
+// protocol registered under the name used in the coherence field of the
+// configuration. MESI and MOESI are registered below.
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/nsengupta5/Cache-Simulator/utils"
+)
+
+// The CoherenceState type represents the coherence state of a line held
+// by a core. The protocols use the subset of the states they need.
+type CoherenceState uint8
+
+// The coherence states of a line. A line held in an owned or modified
+// state is dirty: it is more recent than the copy in the shared levels,
+// and has to be written back when it leaves the core.
+const (
+	StateInvalid CoherenceState = iota
+	StateShared
+	StateExclusive
+	StateOwned
+	StateModified
+)
+
+// IsDirty returns true if the state holds data more recent than the copy
+// in the shared levels
+func (state CoherenceState) IsDirty() bool {
+	return state == StateOwned || state == StateModified
+}
+
+// String returns the usual letter of the state
+func (state CoherenceState) String() string {
+	return [...]string{"I", "S", "E", "O", "M"}[state]
+}
+
+// The BusTransaction type represents the transactions a core can broadcast
+// on the bus
+type BusTransaction uint8
+
+// The bus transactions. A read miss broadcasts a read, a write miss a read
+// for ownership, and a write to a line already held without the right to
+// write it an upgrade, which doesn't need the data.
+const (
+	NoTransaction BusTransaction = iota
+	BusRead
+	BusReadExclusive
+	BusUpgrade
+)
+
+// The CoherenceProtocol interface is a contract for implementing the
+// transitions of a coherence protocol
+type CoherenceProtocol interface {
+	// Request returns the transaction a core has to broadcast to read or
+	// write a line it holds in the given state, if any
+	Request(state CoherenceState, write bool) BusTransaction
+
+	// Snoop returns the new state of a line held by a core that sees the
+	// transaction of another core, and whether the core supplies the line
+	Snoop(state CoherenceState, transaction BusTransaction) (CoherenceState, bool)
+
+	// Next returns the state of a line once its core has read or written
+	// it, given whether other cores still hold it
+	Next(state CoherenceState, write bool, shared bool) CoherenceState
+}
+
+// The CoherenceStats struct counts the coherence activity of a core
+type CoherenceStats struct {
+	Transactions    int // The transactions broadcast by the core
+	Upgrades        int // The upgrades among them
+	Invalidations   int // The lines of the core invalidated by the transactions of other cores
+	Interventions   int // The lines the core supplied to other cores
+	Writebacks      int // The dirty lines written back when snooped
+	CoherenceMisses int // The misses on lines lost to invalidations
+
+	invalidated map[uint64]bool // The lines lost to invalidations and not accessed since
+}
+
+// The SnoopResult struct describes the outcome of a transaction
+type SnoopResult struct {
+	Shared     bool        // Whether other cores still hold the line
+	Supplied   bool        // Whether another core supplied the line
+	Writebacks []Writeback // The dirty lines other cores have to write back
+}
+
+// The Writeback struct represents a dirty line a core has to write back to
+// the shared levels
+type Writeback struct {
+	Core    int
+	Address uint64
+}
+
+var protocols = map[string]CoherenceProtocol{}
+
+// RegisterProtocol makes a coherence protocol available under the given
+// name. It panics if the name is empty or already registered, or if the
+// protocol is nil. Protocols must be registered before the caches are
+// initialized, typically from an init function.
+func RegisterProtocol(name string, protocol CoherenceProtocol) {
+	if name == "" {
+		panic("cache: RegisterProtocol with an empty name")
+	}
+	if protocol == nil {
+		panic(fmt.Sprintf("cache: RegisterProtocol %q with a nil protocol", name))
+	}
+	if _, exists := protocols[name]; exists {
+		panic(fmt.Sprintf("cache: RegisterProtocol called twice for %q", name))
+	}
+	protocols[name] = protocol
+}
+
+// ProtocolNames returns the sorted names of the registered protocols
+func ProtocolNames() []string {
+	names := make([]string, 0, len(protocols))
+	for name := range protocols {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func init() {
+	RegisterProtocol("mesi", MESI{})
+	RegisterProtocol("moesi", MOESI{})
+}
+
+/* ------------------- Coherence Config Function ------------------- */
+
+// SetCoherence sets the coherence protocol of the hierarchy, if one is
+// configured, and finds the private caches of every core
+func (config *CacheConfig) SetCoherence() {
+	if config.Coherence == "" {
+		return
+	}
+
+	protocol, ok := protocols[config.Coherence]
+	if !ok {
+		utils.Check(fmt.Errorf("unknown coherence protocol %q", config.Coherence))
+	}
+	config.Protocol = protocol
+
+	config.CoherenceStats = make([]CoherenceStats, config.Cores)
+	config.private = make([][]int, config.Cores)
+	config.others = make([][]int, config.Cores)
+	for core := range config.CoherenceStats {
+		config.CoherenceStats[core].invalidated = map[uint64]bool{}
+		for other := 0; other < config.Cores; other++ {
+			if other != core {
+				config.others[core] = append(config.others[core], other)
+			}
+		}
+		for i, cache := range config.Caches {
+			if cache.Private && cache.Core == core {
+				config.private[core] = append(config.private[core], i)
+			}
+		}
+	}
+}
+
+// IsCoherent returns true if the given cache is kept coherent, which is
+// the case of the private caches when a protocol is configured
+func (config *CacheConfig) IsCoherent(level int) bool {
+	return config.Protocol != nil && config.Caches[level].Private
+}
+
+// CoherenceState returns the state of the line at the given address in
+// the private caches of the given core
+func (config *CacheConfig) CoherenceState(core int, lineAddress uint64) CoherenceState {
+	for _, i := range config.private[core] {
+		cache := &config.Caches[i]
+		index, tag, _ := cache.GetMemoryInfo(lineAddress)
+		if hit, line := cache.CheckHitOrMiss(tag, index); hit {
+			return line.State
+		}
+	}
+	return StateInvalid
+}
+
+// SetCoherenceState sets the state of every copy of the line at the given
+// address in the private caches of the given core. The copies of a line
+// moving to the invalid state are invalidated, and a line moving to a
+// clean state is no longer dirty.
+func (config *CacheConfig) SetCoherenceState(core int, lineAddress uint64, state CoherenceState) {
+	for _, i := range config.private[core] {
+		cache := &config.Caches[i]
+		index, tag, _ := cache.GetMemoryInfo(lineAddress)
+		hit, line := cache.CheckHitOrMiss(tag, index)
+		switch {
+		case !hit:
+		case state == StateInvalid:
+			cache.Invalidate(tag, index)
+		default:
+			line.State = state
+			line.Dirty = line.Dirty && state.IsDirty()
+		}
+	}
+}
+
+// Request returns the transaction the given core has to broadcast to read
+// or write the line at the given address, along with the state of the line
+// in the core. A miss on a line the core lost to an invalidation counts as
+// a coherence miss.
+func (config *CacheConfig) Request(core int, lineAddress uint64, write bool) (CoherenceState, BusTransaction) {
+	stats := &config.CoherenceStats[core]
+	state := config.CoherenceState(core, lineAddress)
+	if state == StateInvalid && stats.invalidated[lineAddress] {
+		stats.CoherenceMisses++
+	}
+	delete(stats.invalidated, lineAddress)
+
+	transaction := config.Protocol.Request(state, write)
+	if transaction != NoTransaction {
+		stats.Transactions++
+	}
+	if transaction == BusUpgrade {
+		stats.Upgrades++
+	}
+	return state, transaction
+}
+
+// Snoop broadcasts the transaction of the given core for the line at the
+// given address, moving the line to its new state in every other core
+// holding it. A dirty line left valid but clean has to be written back by
+// its core, whereas a dirty line invalidated by a transaction moves to the
+// requesting core, which becomes its owner. With a directory, the
+// transaction only goes to the cores the directory records as sharers.
+func (config *CacheConfig) Snoop(core int, lineAddress uint64, transaction BusTransaction) SnoopResult {
+	result := SnoopResult{}
+	targets := config.others[core]
+	var entry *directoryEntry
+	if config.Directory != nil {
+		entry, targets = config.directoryTargets(core, lineAddress, &result)
+	}
+
+	sharers := []int{}
+	for _, other := range targets {
+		state := config.CoherenceState(other, lineAddress)
+		if state == StateInvalid {
+			continue
+		}
+
+		stats := &config.CoherenceStats[other]
+		next, supplies := config.Protocol.Snoop(state, transaction)
+		if supplies {
+			stats.Interventions++
+			result.Supplied = true
+		}
+		if state.IsDirty() && next != StateInvalid && !next.IsDirty() {
+			stats.Writebacks++
+			result.Writebacks = append(result.Writebacks, Writeback{Core: other, Address: lineAddress})
+		}
+		if next == StateInvalid {
+			stats.Invalidations++
+			stats.invalidated[lineAddress] = true
+		} else {
+			result.Shared = true
+			sharers = append(sharers, other)
+		}
+		config.SetCoherenceState(other, lineAddress, next)
+	}
+
+	if entry != nil {
+		config.Directory.record(entry, append(sharers, core))
+	}
+	return result
+}
+
+// SharedLevel returns the first level the misses of the private caches of
+// the given core reach, which may be main memory
+func (config *CacheConfig) SharedLevel(core int) int {
+	level := config.FirstLevel(core, false)
+	for level < len(config.Caches) && config.Caches[level].Private {
+		level = config.Caches[level].Next
+	}
+	return level
+}
+
+// coherenceStats returns the coherence statistics of the given core
+func (config *CacheConfig) coherenceStats(core int) map[string]interface{} {
+	stats := config.CoherenceStats[core]
+	return map[string]interface{}{
+		"protocol":         config.Coherence,
+		"transactions":     stats.Transactions,
+		"upgrades":         stats.Upgrades,
+		"invalidations":    stats.Invalidations,
+		"interventions":    stats.Interventions,
+		"writebacks":       stats.Writebacks,
+		"coherence_misses": stats.CoherenceMisses,
+	}
+}
+
+// validateCoherence checks that the coherence protocol is registered and
+// that the hierarchy can be kept coherent. Lines are kept coherent as a
+// whole, so every level must use the same line size, and the lines moving
+// between levels in an exclusive hierarchy, between a cache and its victim
+// cache, or brought in by a prefetcher, would escape the protocol.
+func (config *CacheConfig) validateCoherence() []ConfigError {
+	errs := []ConfigError{}
+	if config.Coherence == "" {
+		return errs
+	}
+	if _, ok := protocols[config.Coherence]; !ok {
+		errs = append(errs, ConfigError{
+			Path: "coherence",
+			Message: fmt.Sprintf("unknown protocol %q, expected one of %s",
+				config.Coherence, strings.Join(ProtocolNames(), ", ")),
+		})
+	}
+	if config.Inclusion == Exclusive {
+		errs = append(errs, ConfigError{
+			Path:    "inclusion",
+			Message: "an exclusive hierarchy can't be kept coherent",
+		})
+	}
+
+	for i, cache := range config.Caches {
+		path := fmt.Sprintf("caches[%d]", i)
+		if cache.LineSize != config.Caches[0].LineSize {
+			errs = append(errs, ConfigError{
+				Cache:   cache.Name,
+				Path:    path + ".line_size",
+				Message: "must match the line size of the other levels in a coherent hierarchy",
+			})
+		}
+		if !cache.Private {
+			continue
+		}
+		if cache.PrefetcherConfig != nil {
+			errs = append(errs, ConfigError{
+				Cache:   cache.Name,
+				Path:    path + ".prefetcher",
+				Message: "private caches can't prefetch in a coherent hierarchy",
+			})
+		}
+		if cache.VictimConfig != nil {
+			errs = append(errs, ConfigError{
+				Cache:   cache.Name,
+				Path:    path + ".victim_cache",
+				Message: "private caches can't have a victim cache in a coherent hierarchy",
+			})
+		}
+	}
+	return errs
+}
+
+/* ------------------- Built-in Protocols ------------------- */
+
+// The MESI struct implements the MESI protocol. A line read by a single
+// core is exclusive, so that the core can write it without a transaction.
+// A modified line snooped by a read is written back and becomes shared.
+type MESI struct{}
+
+// Request broadcasts a read or a read for ownership on a miss, and an
+// upgrade to write a shared line
+func (MESI) Request(state CoherenceState, write bool) BusTransaction {
+	switch {
+	case state == StateInvalid && write:
+		return BusReadExclusive
+	case state == StateInvalid:
+		return BusRead
+	case state == StateShared && write:
+		return BusUpgrade
+	}
+	return NoTransaction
+}
+
+// Snoop shares the line on a read, supplying it if it is modified, and
+// invalidates it on a read for ownership or an upgrade
+func (MESI) Snoop(state CoherenceState, transaction BusTransaction) (CoherenceState, bool) {
+	if transaction == BusRead {
+		return StateShared, state == StateModified
+	}
+	return StateInvalid, state == StateModified && transaction == BusReadExclusive
+}
+
+// Next modifies a written line, and makes a line read on a miss exclusive
+// if no other core holds it
+func (MESI) Next(state CoherenceState, write bool, shared bool) CoherenceState {
+	switch {
+	case write:
+		return StateModified
+	case state != StateInvalid:
+		return state
+	case shared:
+		return StateShared
+	}
+	return StateExclusive
+}
+
+// The MOESI struct implements the MOESI protocol, which extends MESI with
+// the owned state. A modified line snooped by a read is supplied without
+// being written back, its core keeping the ownership of the dirty line
+// while the other cores share it.
+type MOESI struct{}
+
+// Request broadcasts a read or a read for ownership on a miss, and an
+// upgrade to write a shared or owned line
+func (MOESI) Request(state CoherenceState, write bool) BusTransaction {
+	switch {
+	case state == StateInvalid && write:
+		return BusReadExclusive
+	case state == StateInvalid:
+		return BusRead
+	case (state == StateShared || state == StateOwned) && write:
+		return BusUpgrade
+	}
+	return NoTransaction
+}
+
+// Snoop keeps a dirty line owned on a read, supplying it, and invalidates
+// the line on a read for ownership or an upgrade
+func (MOESI) Snoop(state CoherenceState, transaction BusTransaction) (CoherenceState, bool) {
+	if transaction == BusRead {
+		if state.IsDirty() {
+			return StateOwned, true
+		}
+		return StateShared, false
+	}
+	return StateInvalid, state.IsDirty() && transaction == BusReadExclusive
+}
+
+// Next modifies a written line, and makes a line read on a miss exclusive
+// if no other core holds it
+func (MOESI) Next(state CoherenceState, write bool, shared bool) CoherenceState {
+	return MESI{}.Next(state, write, shared)
+}
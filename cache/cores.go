@@ -0,0 +1,175 @@
+package cache
+
+// This file contains the multi-core configuration of the hierarchy. A
+// configuration with several cores gives every core its own copy of the
+// caches marked as private, such as the L1 and L2, while the other caches,
+// such as the L3, are shared by all cores. The copies are made when the
+// caches are initialized: each private cache is replaced by one cache per
+// core, whose next level is the copy of the same core if that level is
+// private too, so that the hierarchy becomes a tree whose branches meet at
+// the shared levels. The private caches are only kept coherent if a
+// coherence protocol is configured, otherwise every core simply works on
+// its own copy of the lines.
+//
+// The cores run their own streams of accesses, which the simulator
+// interleaves either round-robin, each core making one access in turn, or
+// by the timestamps of the accesses.
+
+import "fmt"
+
+// The ways the streams of the cores can be interleaved
+const (
+	RoundRobin string = "round-robin"
+	Timestamp  string = "timestamp"
+)
+
+// The CoreStats struct counts the accesses made by a core
+type CoreStats struct {
+	Instructions   int
+	Reads          int
+	Writes         int
+	Fetches        int
+	MemoryAccesses int
+}
+
+// The SharedCoreStats struct counts the accesses of a core to a shared
+// cache, and the lines of the core that other cores evicted from it
+type SharedCoreStats struct {
+	Hits               int
+	Misses             int
+	InterCoreEvictions int
+}
+
+// SetCores sets the default number of cores and interleaving, and gives
+// every core its own copy of the private caches. The copies of a private
+// cache are named after the cache and their core.
+func (config *CacheConfig) SetCores() {
+	if config.Cores == 0 {
+		config.Cores = 1
+	}
+	if config.Interleave == "" {
+		config.Interleave = RoundRobin
+	}
+	config.CoreStats = make([]CoreStats, config.Cores)
+	if config.Cores == 1 {
+		return
+	}
+
+	// The next levels are resolved on the original caches, as copying the
+	// private caches changes their positions
+	nextLevels := make([]string, len(config.Caches))
+	for i, cache := range config.Caches {
+		switch {
+		case cache.NextLevel != "":
+			nextLevels[i] = cache.NextLevel
+		case i+1 < len(config.Caches):
+			nextLevels[i] = config.Caches[i+1].Name
+		default:
+			nextLevels[i] = MemoryLevel
+		}
+	}
+	private := map[string]bool{}
+	for _, cache := range config.Caches {
+		private[cache.Name] = cache.Private
+	}
+
+	caches := []Cache{}
+	for i, cache := range config.Caches {
+		if !cache.Private {
+			cache.NextLevel = nextLevels[i]
+			cache.SharedStats = make([]SharedCoreStats, config.Cores)
+			caches = append(caches, cache)
+			continue
+		}
+		for core := 0; core < config.Cores; core++ {
+			coreCache := cache
+			coreCache.Name = CoreCacheName(cache.Name, core)
+			coreCache.Core = core
+			coreCache.NextLevel = nextLevels[i]
+			if private[nextLevels[i]] {
+				coreCache.NextLevel = CoreCacheName(nextLevels[i], core)
+			}
+			caches = append(caches, coreCache)
+		}
+	}
+	config.Caches = caches
+}
+
+// CoreCacheName returns the name of the copy of a private cache owned by
+// the given core
+func CoreCacheName(name string, core int) string {
+	return fmt.Sprintf("%s (core %d)", name, core)
+}
+
+// IsMultiCore returns true if the configuration has several cores
+func (config *CacheConfig) IsMultiCore() bool {
+	return config.Cores > 1
+}
+
+// servesCore returns true if the cache at the given level can be reached
+// by the accesses of the given core
+func (config *CacheConfig) servesCore(level int, core int) bool {
+	cache := &config.Caches[level]
+	return !cache.Private || cache.Core == core
+}
+
+// coreStats returns the statistics of every core
+func (config *CacheConfig) coreStats() []map[string]interface{} {
+	stats := []map[string]interface{}{}
+	for core, counts := range config.CoreStats {
+		coreStats := map[string]interface{}{
+			"core":                 core,
+			"instructions":         counts.Instructions,
+			"reads":                counts.Reads,
+			"writes":               counts.Writes,
+			"fetches":              counts.Fetches,
+			"main_memory_accesses": counts.MemoryAccesses,
+		}
+		if config.Protocol != nil {
+			coreStats["coherence"] = config.coherenceStats(core)
+		}
+		stats = append(stats, coreStats)
+	}
+	return stats
+}
+
+// validateCores checks the number of cores and the interleaving, and that
+// no shared cache passes its misses to a private cache, which only one
+// core could reach
+func (config *CacheConfig) validateCores() []ConfigError {
+	errs := []ConfigError{}
+	if config.Cores < 0 {
+		errs = append(errs, ConfigError{
+			Path:    "cores",
+			Message: fmt.Sprintf("must not be negative, got %d", config.Cores),
+		})
+	}
+	switch config.Interleave {
+	case "", RoundRobin, Timestamp:
+	default:
+		errs = append(errs, ConfigError{
+			Path:    "interleave",
+			Message: fmt.Sprintf("unknown interleaving %q, expected %s or %s", config.Interleave, RoundRobin, Timestamp),
+		})
+	}
+
+	for i, cache := range config.Caches {
+		next := i + 1
+		for j, other := range config.Caches {
+			if cache.NextLevel != "" && other.Name == cache.NextLevel {
+				next = j
+			}
+		}
+		if cache.NextLevel == MemoryLevel || next >= len(config.Caches) {
+			continue
+		}
+		if !cache.Private && config.Caches[next].Private {
+			errs = append(errs, ConfigError{
+				Cache:   cache.Name,
+				Path:    fmt.Sprintf("caches[%d].private", i),
+				Message: fmt.Sprintf("a shared cache can't pass its misses to the private cache %q", config.Caches[next].Name),
+			})
+		}
+	}
+	return errs
+}
@@ -0,0 +1,75 @@
+package cache
+
+// This file contains the insertion policy variants of LRU, which keep the
+// LRU ordering of the lines but change where new lines are inserted in it.
+// Plain LRU inserts every line at the MRU position, so a streaming working
+// set larger than the cache evicts every line before it is reused.
+//   - LRU insertion (LIP) inserts lines at the LRU position, so a new line
+//     is only kept if it is reused before the next miss in the set.
+//   - Bimodal insertion (BIP) inserts most lines at the LRU position and a
+//     fraction epsilon at the MRU position, so that part of a working set
+//     larger than the cache can stay in it.
+//   - Dynamic insertion (DIP) uses set dueling to pick LRU or BIP for the
+//     whole cache depending on which one misses the least.
+
+import "math/rand"
+
+// The insertionPolicy struct decides where an LRU policy inserts new lines
+type insertionPolicy struct {
+	mode    int
+	epsilon float64
+	rng     *rand.Rand
+	set     int         // The index of the set, used for set dueling
+	dueling *SetDueling // The set dueling state shared by the sets of the cache
+}
+
+// The insertion modes of the LRU variants
+const (
+	lruInsertion int = iota
+	bimodalLRUInsertion
+	dynamicLRUInsertion
+)
+
+func NewLIP(capacity int) *LRU {
+	lru := NewLRU(capacity)
+	lru.insertion = &insertionPolicy{mode: lruInsertion}
+	return lru
+}
+
+// NewBIP creates a BIP policy drawing the MRU insertions from the given
+// random number generator
+func NewBIP(capacity int, params PolicyParams, rng *rand.Rand) *LRU {
+	lru := NewLRU(capacity)
+	lru.insertion = &insertionPolicy{
+		mode:    bimodalLRUInsertion,
+		epsilon: params.Float("epsilon", defaultEpsilon),
+		rng:     rng,
+	}
+	return lru
+}
+
+// NewDIP creates a DIP policy for the set with the given index, using the
+// set dueling state of its cache, in which LRU is the first policy and BIP
+// the second
+func NewDIP(capacity int, params PolicyParams, rng *rand.Rand, set int, dueling *SetDueling) *LRU {
+	lru := NewBIP(capacity, params, rng)
+	lru.insertion.mode = dynamicLRUInsertion
+	lru.insertion.set = set
+	lru.insertion.dueling = dueling
+	return lru
+}
+
+// atMRU returns true if a new line is inserted at the MRU position
+// Every insertion follows a miss, which is recorded for set dueling
+func (ip *insertionPolicy) atMRU() bool {
+	switch ip.mode {
+	case lruInsertion:
+		return false
+	case dynamicLRUInsertion:
+		ip.dueling.Miss(ip.set)
+		if !ip.dueling.UseB(ip.set) {
+			return true
+		}
+	}
+	return ip.rng.Float64() < ip.epsilon
+}
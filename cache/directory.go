@@ -0,0 +1,351 @@
+package cache
+
+// This file contains the sparse directory, an alternative to the snooping
+// bus for larger numbers of cores. Instead of broadcasting every
+// transaction to all cores, a core sends it to the directory, which
+// forwards it only to the cores it records as sharers of the line. The
+// directory is sparse: it has a fixed number of entries organized in sets
+// like a cache, and allocating an entry for a new line may evict the entry
+// of another line, whose copies in the private caches are then invalidated,
+// as the directory can no longer track them.
+//
+// The sharers of an entry are recorded either as a full bit vector, with
+// one bit per core, or as a limited number of pointers to cores. An entry
+// with more sharers than pointers overflows, and its transactions are
+// broadcast to all cores, like on a snooping bus.
+//
+// A core notifies the directory once a line has left all of its private
+// caches, whether it was evicted, back-invalidated or not kept after a
+// write miss, and the directory removes the core from the sharers of the
+// line. An entry left without sharers is freed, so that it doesn't take
+// the place of a line still in use. The sharers of an overflowed entry are
+// no longer known, so such an entry stays until the directory evicts it.
+
+import (
+	"fmt"
+	"math/bits"
+)
+
+// The formats of the sharers of the directory entries
+const (
+	FullBitVector  string = "bit-vector"
+	LimitedPointer string = "limited-pointer"
+)
+
+// The default geometry of the directory
+const (
+	defaultDirectoryWays     int = 8
+	defaultDirectoryPointers int = 4
+)
+
+// The DirectoryConfig struct represents the configuration of the sparse
+// directory of a coherent hierarchy
+type DirectoryConfig struct {
+	Entries       int    `json:"entries"`       // The number of lines tracked
+	Associativity int    `json:"associativity"` // The number of entries per set, 8 by default
+	Sharers       string `json:"sharers"`       // The format of the sharers, a full bit vector by default
+	Pointers      int    `json:"pointers"`      // The number of pointers of a limited pointer entry, 4 by default
+}
+
+// The directoryEntry struct records the sharers of a line
+type directoryEntry struct {
+	sharers  []int // The cores that may hold the line
+	overflow bool  // Whether the sharers exceed the pointers of the entry
+}
+
+// The Directory struct holds the entries of the sparse directory and
+// counts its activity
+type Directory struct {
+	config  DirectoryConfig
+	cores   int
+	tags    *Cache             // The lines tracked by the entries, and their replacement
+	entries [][]directoryEntry // The entry held in each way of each set
+
+	Lookups       int // The transactions handled by the directory
+	Used          int // The entries tracking a line
+	PeakUsed      int // The largest number of entries used at once
+	usedSum       int // The entries used at each lookup, summed for the mean occupancy
+	Evictions     int // The entries evicted to track another line
+	Invalidations int // The copies invalidated by the evictions
+	Overflows     int // The entries whose sharers exceeded their pointers
+	Broadcasts    int // The transactions sent to all cores by an overflowed entry
+	Messages      int // The requests sent to the directory and the messages it sent to the cores
+	SnoopMessages int // The messages a snooping bus would have sent for the same transactions
+}
+
+// NewDirectory creates the directory described by the given configuration,
+// for a hierarchy with the given number of cores and line size
+func NewDirectory(config DirectoryConfig, cores int, lineSize int, addressBits int) *Directory {
+	if config.Associativity == 0 {
+		config.Associativity = defaultDirectoryWays
+		if config.Entries < config.Associativity {
+			config.Associativity = config.Entries
+		}
+	}
+	if config.Sharers == "" {
+		config.Sharers = FullBitVector
+	}
+	if config.Pointers == 0 {
+		config.Pointers = defaultDirectoryPointers
+	}
+
+	tags := &Cache{
+		Name:          "directory",
+		Size:          config.Entries * lineSize,
+		LineSize:      lineSize,
+		Associativity: config.Associativity,
+		PolicyName:    "lru",
+	}
+	tags.SetSetsSize()
+	tags.SetLinesSize()
+	tags.SetBitsSize(addressBits)
+	tags.SetDefaultPolicy()
+
+	entries := make([][]directoryEntry, len(tags.Sets))
+	for i := range entries {
+		entries[i] = make([]directoryEntry, config.Associativity)
+	}
+	return &Directory{
+		config:  config,
+		cores:   cores,
+		tags:    tags,
+		entries: entries,
+	}
+}
+
+// entry returns the entry tracking the line at the given address,
+// allocating one if the line isn't tracked yet. It also returns the
+// address and the entry of the line evicted to make room for it, and a
+// boolean indicating if an entry was evicted.
+func (directory *Directory) entry(lineAddress uint64, access Access) (*directoryEntry, uint64, directoryEntry, bool) {
+	tags := directory.tags
+	index, tag, _ := tags.GetMemoryInfo(lineAddress)
+	set := &tags.Sets[index]
+	if hit, line := tags.CheckHitOrMiss(tag, index); hit {
+		set.Policy.Update(line, access)
+		return &directory.entries[index][line.Index], 0, directoryEntry{}, false
+	}
+
+	line := &CacheLine{Tag: tag, Valid: true, Index: -1, Freq: 1}
+	evictedLine, wasEvicted := set.Insert(line, access)
+	way := line.Index
+	evicted := directory.entries[index][way]
+	directory.entries[index][way] = directoryEntry{}
+	if !wasEvicted {
+		directory.Used++
+		if directory.Used > directory.PeakUsed {
+			directory.PeakUsed = directory.Used
+		}
+		return &directory.entries[index][way], 0, directoryEntry{}, false
+	}
+	directory.Evictions++
+	return &directory.entries[index][way], tags.GetAddress(evictedLine.Tag, index), evicted, true
+}
+
+// release removes the given core from the sharers of the line at the
+// given address, freeing the entry once no core shares the line. The
+// sharers of an overflowed entry are unknown, so it is kept. It returns
+// true if the core was removed.
+func (directory *Directory) release(core int, lineAddress uint64) bool {
+	tags := directory.tags
+	index, tag, _ := tags.GetMemoryInfo(lineAddress)
+	hit, line := tags.CheckHitOrMiss(tag, index)
+	if !hit {
+		return false
+	}
+	entry := &directory.entries[index][line.Index]
+	if entry.overflow {
+		return false
+	}
+
+	for i, sharer := range entry.sharers {
+		if sharer != core {
+			continue
+		}
+		entry.sharers = append(entry.sharers[:i:i], entry.sharers[i+1:]...)
+		if len(entry.sharers) == 0 {
+			tags.Invalidate(tag, index)
+			*entry = directoryEntry{}
+			directory.Used--
+		}
+		return true
+	}
+	return false
+}
+
+// targets returns the cores a transaction on a line with the given entry
+// is sent to, all of them if the entry has overflowed
+func (directory *Directory) targets(entry directoryEntry) []int {
+	if !entry.overflow {
+		return entry.sharers
+	}
+	cores := make([]int, directory.cores)
+	for core := range cores {
+		cores[core] = core
+	}
+	return cores
+}
+
+// record sets the sharers of an entry, which overflows if a limited
+// pointer entry can't hold them
+func (directory *Directory) record(entry *directoryEntry, sharers []int) {
+	overflow := directory.config.Sharers == LimitedPointer && len(sharers) > directory.config.Pointers
+	if overflow && !entry.overflow {
+		directory.Overflows++
+	}
+	entry.sharers, entry.overflow = sharers, overflow
+	if overflow {
+		entry.sharers = nil
+	}
+}
+
+// sharerBits returns the number of bits recording the sharers of an entry
+func (directory *Directory) sharerBits() int {
+	if directory.config.Sharers != LimitedPointer {
+		return directory.cores
+	}
+	pointerBits := bits.Len(uint(directory.cores - 1))
+	return directory.config.Pointers*pointerBits + 1
+}
+
+// Stats returns the occupancy of the directory, the invalidations caused
+// by its evictions, and its traffic compared to a snooping bus
+func (directory *Directory) Stats() map[string]interface{} {
+	meanUsed := 0.0
+	if directory.Lookups > 0 {
+		meanUsed = float64(directory.usedSum) / float64(directory.Lookups)
+	}
+	entries := directory.config.Entries
+	return map[string]interface{}{
+		"entries":           entries,
+		"associativity":     directory.config.Associativity,
+		"sharers":           directory.config.Sharers,
+		"sharer_bits":       directory.sharerBits(),
+		"lookups":           directory.Lookups,
+		"used_entries":      directory.Used,
+		"peak_used_entries": directory.PeakUsed,
+		"occupancy":         float64(directory.Used) / float64(entries),
+		"mean_occupancy":    meanUsed / float64(entries),
+		"evictions":         directory.Evictions,
+		"invalidations":     directory.Invalidations,
+		"overflows":         directory.Overflows,
+		"broadcasts":        directory.Broadcasts,
+		"messages":          directory.Messages,
+		"snooping_messages": directory.SnoopMessages,
+	}
+}
+
+/* ------------------- Directory Config Function ------------------- */
+
+// SetDirectory creates the sparse directory of the hierarchy, if one is
+// configured
+func (config *CacheConfig) SetDirectory() {
+	if config.DirectoryConfig == nil || config.Protocol == nil {
+		return
+	}
+	config.Directory = NewDirectory(*config.DirectoryConfig, config.Cores, config.Caches[0].LineSize, config.AddressBits)
+}
+
+// directoryTargets looks up the entry of the line at the given address in
+// the directory, and returns the cores other than the requesting one the
+// transaction is forwarded to. If allocating the entry evicted the entry of
+// another line, every copy of that line is invalidated, and the dirty ones
+// are added to the write-backs of the result.
+func (config *CacheConfig) directoryTargets(core int, lineAddress uint64, result *SnoopResult) (*directoryEntry, []int) {
+	directory := config.Directory
+	directory.Lookups++
+	directory.usedSum += directory.Used
+	directory.SnoopMessages += config.Cores - 1
+
+	access := Access{Time: uint64(directory.Lookups), Address: lineAddress}
+	entry, evictedAddress, evicted, wasEvicted := directory.entry(lineAddress, access)
+	if wasEvicted {
+		for _, sharer := range directory.targets(evicted) {
+			directory.Messages++
+			state := config.CoherenceState(sharer, evictedAddress)
+			if state == StateInvalid {
+				continue
+			}
+			directory.Invalidations++
+			config.CoherenceStats[sharer].invalidated[evictedAddress] = true
+			if state.IsDirty() {
+				result.Writebacks = append(result.Writebacks, Writeback{Core: sharer, Address: evictedAddress})
+			}
+			config.SetCoherenceState(sharer, evictedAddress, StateInvalid)
+		}
+	}
+
+	// The request itself is a message to the directory
+	directory.Messages++
+	if entry.overflow {
+		directory.Broadcasts++
+	}
+	targets := []int{}
+	for _, sharer := range directory.targets(*entry) {
+		if sharer != core {
+			targets = append(targets, sharer)
+			directory.Messages++
+		}
+	}
+	return entry, targets
+}
+
+// ReleaseLine notifies the directory that a line left a private cache of
+// the given core. If the core no longer holds the line in any of its
+// private caches, it is removed from the sharers of the line.
+func (config *CacheConfig) ReleaseLine(core int, lineAddress uint64) {
+	if config.Directory == nil || config.CoherenceState(core, lineAddress) != StateInvalid {
+		return
+	}
+	if config.Directory.release(core, lineAddress) {
+		config.Directory.Messages++
+	}
+}
+
+// validateDirectory checks the configuration of the directory
+func (config *CacheConfig) validateDirectory() []ConfigError {
+	errs := []ConfigError{}
+	if config.DirectoryConfig == nil {
+		return errs
+	}
+	fail := func(field string, format string, args ...interface{}) {
+		errs = append(errs, ConfigError{
+			Path:    "directory." + field,
+			Message: fmt.Sprintf(format, args...),
+		})
+	}
+
+	directory := config.DirectoryConfig
+	if config.Coherence == "" {
+		errs = append(errs, ConfigError{
+			Path:    "directory",
+			Message: "a directory needs a coherence protocol",
+		})
+	}
+	ways := directory.Associativity
+	if ways == 0 {
+		ways = defaultDirectoryWays
+		if directory.Entries < ways {
+			ways = directory.Entries
+		}
+	}
+	switch {
+	case directory.Entries <= 0:
+		fail("entries", "must be positive, got %d", directory.Entries)
+	case ways < 0:
+		fail("associativity", "must be positive, got %d", ways)
+	case directory.Entries%ways != 0:
+		fail("entries", "%d entries can't be divided into %d-way sets", directory.Entries, ways)
+	case !isPowerOfTwo(directory.Entries / ways):
+		fail("entries", "gives %d sets of %d ways, the number of sets must be a power of two", directory.Entries/ways, ways)
+	}
+	switch directory.Sharers {
+	case "", FullBitVector, LimitedPointer:
+	default:
+		fail("sharers", "unknown format %q, expected %s or %s", directory.Sharers, FullBitVector, LimitedPointer)
+	}
+	if directory.Pointers < 0 {
+		fail("pointers", "must not be negative, got %d", directory.Pointers)
+	}
+	return errs
+}
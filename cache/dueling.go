@@ -0,0 +1,114 @@
+package cache
+
+// This file contains the set dueling mechanism used by the dynamic
+// replacement policies to choose between two policies at run time. A few
+// leader sets always use the first policy and a few always use the second.
+// Every miss in a leader set moves a saturating policy selection counter
+// (PSEL) towards the other policy, and the remaining follower sets use the
+// policy whose leaders miss the least. The state is shared by all the sets
+// of a cache, which the per-set replacement policies can't hold on their
+// own, so each set holds a pointer to the SetDueling of its cache.
+
+// The default parameters of set dueling
+const (
+	defaultLeaderSets   int = 32
+	defaultPSELBits     int = 10
+	defaultPSELInterval int = 10000
+)
+
+// The roles of a set in set dueling
+const (
+	follower int = iota
+	leaderA
+	leaderB
+)
+
+// The SetDueling struct holds the set dueling state of a cache
+type SetDueling struct {
+	roles      []int // The role of each set
+	psel       int   // The policy selection counter
+	maxPSEL    int
+	interval   int   // The number of misses between two samples of PSEL
+	misses     int   // The number of misses since the last sample
+	trajectory []int // The samples of PSEL
+}
+
+// NewSetDueling creates the set dueling state for a cache with the given
+// number of sets. Up to leaderSets sets lead each policy, spread evenly
+// over the cache. A cache with a single set has no leaders and always
+// uses the first policy.
+func NewSetDueling(numSets int, leaderSets int, pselBits int, interval int) *SetDueling {
+	maxPSEL := 1<<pselBits - 1
+	dueling := &SetDueling{
+		roles:    make([]int, numSets),
+		psel:     (maxPSEL + 1) / 2,
+		maxPSEL:  maxPSEL,
+		interval: interval,
+	}
+
+	if leaderSets > numSets/2 {
+		leaderSets = numSets / 2
+	}
+	if leaderSets > 0 {
+		stride := numSets / leaderSets
+		for i := 0; i < leaderSets; i++ {
+			dueling.roles[i*stride] = leaderA
+			dueling.roles[i*stride+stride/2] = leaderB
+		}
+	}
+	return dueling
+}
+
+// NewSetDuelingFromParams creates the set dueling state of a cache with
+// the given number of sets from the parameters of its policy
+func NewSetDuelingFromParams(numSets int, params PolicyParams) *SetDueling {
+	return NewSetDueling(
+		numSets,
+		params.Int("leader_sets", defaultLeaderSets),
+		params.Int("psel_bits", defaultPSELBits),
+		params.Int("psel_interval", defaultPSELInterval),
+	)
+}
+
+// UseB returns true if the set with the given index uses the second policy
+func (d *SetDueling) UseB(set int) bool {
+	switch d.roles[set] {
+	case leaderA:
+		return false
+	case leaderB:
+		return true
+	default:
+		return d.psel > d.maxPSEL/2
+	}
+}
+
+// Miss records a miss in the set with the given index. A miss in a leader
+// set of the first policy favours the second policy and vice versa.
+func (d *SetDueling) Miss(set int) {
+	switch d.roles[set] {
+	case leaderA:
+		if d.psel < d.maxPSEL {
+			d.psel++
+		}
+	case leaderB:
+		if d.psel > 0 {
+			d.psel--
+		}
+	}
+
+	d.misses++
+	if d.misses == d.interval {
+		d.trajectory = append(d.trajectory, d.psel)
+		d.misses = 0
+	}
+}
+
+// Stats returns the final value of PSEL and its trajectory
+func (d *SetDueling) Stats() map[string]interface{} {
+	return map[string]interface{}{
+		"psel":            d.psel,
+		"psel_max":        d.maxPSEL,
+		"psel_interval":   d.interval,
+		"psel_trajectory": d.trajectory,
+	}
+}
@@ -0,0 +1,45 @@
+package cache
+
+// This file implements the First In First Out (FIFO) replacement policy
+// The FIFO policy evicts the line that was inserted into the set the
+// longest time ago. Unlike the Round Robin policy, which only rotates a
+// pointer over the ways of the set, FIFO records the order in which the
+// lines were filled, so it stays exact when the set starts partially
+// empty or when lines are invalidated and their ways refilled.
+
+type FIFO struct {
+	order []int // The ways of the set, from the oldest to the newest fill
+}
+
+func NewFIFO(capacity int) *FIFO {
+	return &FIFO{
+		order: make([]int, 0, capacity),
+	}
+}
+
+// Insert records the way of the line as the newest fill
+func (fifo *FIFO) Insert(line *CacheLine, access Access) {
+	fifo.order = append(fifo.order, line.Index)
+}
+
+// No action required to update a line, as hits do not change the order
+func (fifo *FIFO) Update(line *CacheLine, access Access) {
+}
+
+// Evict returns the way of the oldest fill
+func (fifo *FIFO) Evict(access Access) int {
+	evictIndex := fifo.order[0]
+	fifo.order = fifo.order[:copy(fifo.order, fifo.order[1:])]
+	return evictIndex
+}
+
+// Remove forgets the way of a line that has been invalidated, so that
+// the line filled into it next is treated as the newest
+func (fifo *FIFO) Remove(line *CacheLine) {
+	for i, index := range fifo.order {
+		if index == line.Index {
+			fifo.order = append(fifo.order[:i], fifo.order[i+1:]...)
+			return
+		}
+	}
+}
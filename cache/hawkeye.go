@@ -0,0 +1,239 @@
+package cache
+
+// This file contains the implementation of the Hawkeye policy of Jain and
+// Lin. Hawkeye learns from Bélády's optimal policy on past accesses: a few
+// sampled sets run OPTgen, which replays their accesses to decide whether
+// OPT would have kept each line until its next use. The PC of the access
+// that brought the line in or last touched it is then trained towards
+// cache-friendly if OPT would have hit, and towards cache-averse if not.
+//
+// Every line is inserted or hit with the prediction for the PC of the
+// access. Cache-averse lines get the most distant re-reference prediction
+// (RRPV) and are evicted first. Cache-friendly lines get an RRPV of zero,
+// and the other friendly lines of the set age on every insertion. If no
+// line is cache-averse, the oldest friendly line is evicted and its PC is
+// trained towards cache-averse, as the prediction was wrong.
+//
+// OPTgen keeps, for the recent accesses of a set, the number of lines OPT
+// would hold at the time of each access (the occupancy vector). A line
+// reused within the history window would have been kept by OPT if the
+// occupancy stayed below the associativity since its previous use, in
+// which case the line occupies one more way over that interval.
+
+// The default parameters of Hawkeye
+const (
+	defaultPredictorBits int = 11
+	defaultSampledSets   int = 64
+	hawkeyeRRPVBits      int = 3
+	optgenHistory        int = 8 // The history window, as a multiple of the associativity
+)
+
+// The HawkeyePredictor struct holds the predictor shared by the sets of a
+// cache, and the accuracy of its predictions
+type HawkeyePredictor struct {
+	counters *counterTable
+	sampled  []bool // Whether each set is sampled by OPTgen
+	accuracy *pcAccuracy
+}
+
+// NewHawkeyePredictor creates the predictor for a cache with the given
+// number of sets, of which up to sampledSets are sampled, spread evenly
+// over the cache
+func NewHawkeyePredictor(numSets int, params PolicyParams) *HawkeyePredictor {
+	counterBits := params.Int("counter_bits", defaultPCCounterBits)
+	predictor := &HawkeyePredictor{
+		// The counters start weakly cache-friendly
+		counters: newCounterTable(params.Int("predictor_bits", defaultPredictorBits), counterBits, 1<<(counterBits-1)),
+		sampled:  make([]bool, numSets),
+		accuracy: newPCAccuracy(params.Int("pc_stats", defaultPCStats)),
+	}
+
+	sampledSets := params.Int("sampled_sets", defaultSampledSets)
+	if sampledSets > numSets {
+		sampledSets = numSets
+	}
+	stride := numSets / sampledSets
+	for i := 0; i < sampledSets; i++ {
+		predictor.sampled[i*stride] = true
+	}
+	return predictor
+}
+
+// Stats returns the accuracy of the predictions, checked against OPTgen
+// in the sampled sets
+func (predictor *HawkeyePredictor) Stats() map[string]interface{} {
+	return predictor.accuracy.stats()
+}
+
+// friendly returns true if the lines accessed by the PC are predicted to
+// be cache-friendly
+func (predictor *HawkeyePredictor) friendly(pc uint64) bool {
+	return predictor.counters.get(pc) > predictor.counters.max/2
+}
+
+// train moves the counter of the PC towards cache-friendly if OPT would
+// have hit, and towards cache-averse if not
+func (predictor *HawkeyePredictor) train(pc uint64, optHit bool) {
+	if optHit {
+		predictor.counters.increment(pc)
+	} else {
+		predictor.counters.decrement(pc)
+	}
+}
+
+// The optgenSample struct holds the last access to a line of a sampled set
+type optgenSample struct {
+	time     uint64
+	pc       uint64
+	friendly bool // The prediction made for the access
+}
+
+// The optgen struct replays the accesses to a sampled set with OPT
+type optgen struct {
+	capacity  int
+	occupancy []int  // The lines held by OPT at each access of the window
+	time      uint64 // The number of accesses to the set
+	samples   map[uint64]optgenSample
+}
+
+func newOptgen(capacity int) *optgen {
+	return &optgen{
+		capacity:  capacity,
+		occupancy: make([]int, optgenHistory*capacity),
+		samples:   make(map[uint64]optgenSample),
+	}
+}
+
+// access replays an access to the line with the given address, training
+// the predictor with the decision OPT would have made for the previous
+// access to the line
+func (gen *optgen) access(address uint64, pc uint64, friendly bool, predictor *HawkeyePredictor) {
+	window := uint64(len(gen.occupancy))
+	now := gen.time
+	gen.time++
+	gen.occupancy[now%window] = 0
+
+	if sample, ok := gen.samples[address]; ok {
+		optHit := now-sample.time < window
+		for t := sample.time; optHit && t < now; t++ {
+			optHit = gen.occupancy[t%window] < gen.capacity
+		}
+		if optHit {
+			for t := sample.time; t < now; t++ {
+				gen.occupancy[t%window]++
+			}
+		}
+		gen.train(sample, optHit, predictor)
+	}
+	gen.samples[address] = optgenSample{time: now, pc: pc, friendly: friendly}
+
+	// Lines not reused within the window would not have been kept by OPT,
+	// so they are trained and forgotten once per window
+	if gen.time%window == 0 {
+		for address, sample := range gen.samples {
+			if gen.time-sample.time >= window {
+				gen.train(sample, false, predictor)
+				delete(gen.samples, address)
+			}
+		}
+	}
+}
+
+// train trains the predictor with the decision of OPT for a sample, and
+// checks the prediction made for it
+func (gen *optgen) train(sample optgenSample, optHit bool, predictor *HawkeyePredictor) {
+	predictor.train(sample.pc, optHit)
+	predictor.accuracy.record(sample.pc, sample.friendly == optHit)
+}
+
+type Hawkeye struct {
+	rrpv      []int
+	maxRRPV   int
+	pcs       []uint64 // The PC of the last access to the line held in each way
+	optgen    *optgen  // The OPT replay of the set, nil if the set isn't sampled
+	predictor *HawkeyePredictor
+}
+
+// NewHawkeye creates a Hawkeye policy for the set with the given index,
+// using the predictor of its cache
+func NewHawkeye(capacity int, set int, predictor *HawkeyePredictor) *Hawkeye {
+	maxRRPV := 1<<hawkeyeRRPVBits - 1
+	rrpv := make([]int, capacity)
+	for i := range rrpv {
+		rrpv[i] = maxRRPV
+	}
+	hawkeye := &Hawkeye{
+		rrpv:      rrpv,
+		maxRRPV:   maxRRPV,
+		pcs:       make([]uint64, capacity),
+		predictor: predictor,
+	}
+	if predictor.sampled[set] {
+		hawkeye.optgen = newOptgen(capacity)
+	}
+	return hawkeye
+}
+
+// Insert gives a new line an RRPV of zero if it is predicted to be
+// cache-friendly, ageing the other friendly lines, and the most distant
+// RRPV otherwise
+func (hawkeye *Hawkeye) Insert(line *CacheLine, access Access) {
+	friendly := hawkeye.access(line.Index, access)
+	if friendly {
+		for i, rrpv := range hawkeye.rrpv {
+			if rrpv < hawkeye.maxRRPV-1 {
+				hawkeye.rrpv[i]++
+			}
+		}
+	}
+	hawkeye.predict(line.Index, friendly)
+}
+
+// Update gives a line that hit an RRPV of zero if it is predicted to be
+// cache-friendly, and the most distant RRPV otherwise
+func (hawkeye *Hawkeye) Update(line *CacheLine, access Access) {
+	hawkeye.predict(line.Index, hawkeye.access(line.Index, access))
+}
+
+// Evict returns a cache-averse line if there is one, and the friendly
+// line with the largest RRPV otherwise, training its PC towards
+// cache-averse
+func (hawkeye *Hawkeye) Evict(access Access) int {
+	evictIndex := 0
+	for i, rrpv := range hawkeye.rrpv {
+		if rrpv == hawkeye.maxRRPV {
+			return i
+		}
+		if rrpv > hawkeye.rrpv[evictIndex] {
+			evictIndex = i
+		}
+	}
+	hawkeye.predictor.train(hawkeye.pcs[evictIndex], false)
+	return evictIndex
+}
+
+// Remove predicts a distant re-reference for an invalidated line
+func (hawkeye *Hawkeye) Remove(line *CacheLine) {
+	hawkeye.rrpv[line.Index] = hawkeye.maxRRPV
+}
+
+// access records the PC of an access to the line in the given way, replays
+// the access with OPTgen if the set is sampled, and returns the prediction
+// for the PC
+func (hawkeye *Hawkeye) access(way int, access Access) bool {
+	friendly := hawkeye.predictor.friendly(access.PC)
+	hawkeye.pcs[way] = access.PC
+	if hawkeye.optgen != nil {
+		hawkeye.optgen.access(access.Address, access.PC, friendly, hawkeye.predictor)
+	}
+	return friendly
+}
+
+// predict sets the RRPV of the line in the given way from its prediction
+func (hawkeye *Hawkeye) predict(way int, friendly bool) {
+	if friendly {
+		hawkeye.rrpv[way] = 0
+	} else {
+		hawkeye.rrpv[way] = hawkeye.maxRRPV
+	}
+}
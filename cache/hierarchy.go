@@ -0,0 +1,252 @@
+package cache
+
+// This file contains the shape of the cache hierarchy. Every cache passes
+// its misses to a single next level, which is the following cache of the
+// configuration unless its next_level names another cache, or main memory
+// after the last cache. Several caches can share the same next level, so
+// the hierarchy is a tree rooted at main memory, whose leaves are the
+// first-level caches. A first-level cache serves instruction fetches,
+// data accesses or both, so that split L1I and L1D caches can share a
+// unified L2. The caches are still identified by their position in the
+// configuration, and main memory by the number of caches.
+
+import (
+	"fmt"
+	"strings"
+)
+
+// The accesses a first-level cache can serve
+const (
+	ServesInstructions string = "instruction"
+	ServesData         string = "data"
+	ServesUnified      string = "unified"
+)
+
+// The name of main memory in the next_level field of a cache
+const MemoryLevel string = "memory"
+
+// SetHierarchy links every cache to its next level, and finds the
+// first-level caches serving instruction fetches and data accesses
+func (config *CacheConfig) SetHierarchy() {
+	config.linkNextLevels()
+
+	// The caches above a level are the ones whose misses go through it
+	config.above = make([][]int, len(config.Caches))
+	for i := range config.Caches {
+		for j := config.Caches[i].Next; j < len(config.Caches); j = config.Caches[j].Next {
+			config.above[j] = append(config.above[j], i)
+		}
+	}
+
+	// In a multi-core hierarchy, every core has its own first-level caches,
+	// unless the first level is shared
+	config.instructionLevels = make([]int, config.Cores)
+	config.dataLevels = make([]int, config.Cores)
+	for core := 0; core < config.Cores; core++ {
+		for i := range config.Caches {
+			if !config.isFirstLevel(i) || !config.servesCore(i, core) {
+				continue
+			}
+			switch config.Caches[i].Serves {
+			case ServesInstructions:
+				config.instructionLevels[core] = i
+			case ServesData:
+				config.dataLevels[core] = i
+			default:
+				config.instructionLevels[core] = i
+				config.dataLevels[core] = i
+			}
+		}
+	}
+}
+
+// FirstLevel returns the cache serving the instruction fetches, or the
+// data accesses, of the given core
+func (config *CacheConfig) FirstLevel(core int, instruction bool) int {
+	if instruction {
+		return config.instructionLevels[core]
+	}
+	return config.dataLevels[core]
+}
+
+// Above returns the caches whose misses go through the given cache
+func (config *CacheConfig) Above(level int) []int {
+	return config.above[level]
+}
+
+// IsSplit returns true if instruction fetches and data accesses go to
+// different first-level caches
+func (config *CacheConfig) IsSplit() bool {
+	return config.instructionLevels[0] != config.dataLevels[0]
+}
+
+// Reaches returns true if the instruction fetches, or the data accesses,
+// of the given core go through the given cache
+func (config *CacheConfig) Reaches(core int, instruction bool, level int) bool {
+	for j := config.FirstLevel(core, instruction); j < len(config.Caches); j = config.Caches[j].Next {
+		if j == level {
+			return true
+		}
+	}
+	return false
+}
+
+// Branches returns the path from each first-level cache to main memory
+func (config *CacheConfig) Branches() []map[string]interface{} {
+	branches := []map[string]interface{}{}
+	for _, i := range config.firstLevels() {
+		serves := config.Caches[i].Serves
+		if serves == "" {
+			serves = ServesUnified
+		}
+		path := []string{}
+		for j := i; j < len(config.Caches); j = config.Caches[j].Next {
+			path = append(path, config.Caches[j].Name)
+		}
+		branches = append(branches, map[string]interface{}{
+			"serves": serves,
+			"caches": path,
+		})
+	}
+	return branches
+}
+
+// linkNextLevels sets the index of the next level of every cache
+func (config *CacheConfig) linkNextLevels() {
+	for i, next := range config.nextLevels() {
+		config.Caches[i].Next = next
+	}
+}
+
+// nextLevels returns the index of the next level of every cache
+func (config *CacheConfig) nextLevels() []int {
+	levels := map[string]int{MemoryLevel: len(config.Caches)}
+	for i, cache := range config.Caches {
+		levels[cache.Name] = i
+	}
+
+	nextLevels := make([]int, len(config.Caches))
+	for i, cache := range config.Caches {
+		if next, ok := levels[cache.NextLevel]; ok && cache.NextLevel != "" {
+			nextLevels[i] = next
+		} else {
+			nextLevels[i] = i + 1
+		}
+	}
+	return nextLevels
+}
+
+// firstLevels returns the caches that are not the next level of any cache
+func (config *CacheConfig) firstLevels() []int {
+	levels := []int{}
+	for i := range config.Caches {
+		if config.isFirstLevel(i) {
+			levels = append(levels, i)
+		}
+	}
+	return levels
+}
+
+// isFirstLevel returns true if the given cache is not the next level of
+// any cache
+func (config *CacheConfig) isFirstLevel(level int) bool {
+	for _, cache := range config.Caches {
+		if cache.Next == level {
+			return false
+		}
+	}
+	return true
+}
+
+// validateHierarchy checks that the next levels of the caches form a tree
+// rooted at main memory, and that exactly one first-level cache serves
+// instruction fetches and exactly one serves data accesses
+func (config *CacheConfig) validateHierarchy() []ConfigError {
+	errs := []ConfigError{}
+	fail := func(i int, field string, format string, args ...interface{}) {
+		errs = append(errs, ConfigError{
+			Cache:   config.Caches[i].Name,
+			Path:    fmt.Sprintf("caches[%d].%s", i, field),
+			Message: fmt.Sprintf(format, args...),
+		})
+	}
+
+	names := []string{}
+	levels := map[string]int{MemoryLevel: len(config.Caches)}
+	for i, cache := range config.Caches {
+		names = append(names, cache.Name)
+		levels[cache.Name] = i
+	}
+	for i, cache := range config.Caches {
+		next, ok := levels[cache.NextLevel]
+		switch {
+		case cache.NextLevel == "":
+		case !ok:
+			fail(i, "next_level", "unknown cache %q, expected one of %s or %s",
+				cache.NextLevel, strings.Join(names, ", "), MemoryLevel)
+			return errs
+		case next == i:
+			fail(i, "next_level", "a cache can't be its own next level")
+			return errs
+		}
+	}
+
+	// The links can only be followed once they are known to be valid. They
+	// are followed without linking the caches, as validating the
+	// configuration doesn't change it.
+	nextLevels := config.nextLevels()
+	isFirstLevel := func(level int) bool {
+		for _, next := range nextLevels {
+			if next == level {
+				return false
+			}
+		}
+		return true
+	}
+	for i := range config.Caches {
+		steps := 0
+		for j := nextLevels[i]; j < len(config.Caches); j = nextLevels[j] {
+			if steps++; steps > len(config.Caches) {
+				fail(i, "next_level", "the next levels form a cycle instead of reaching %s", MemoryLevel)
+				return errs
+			}
+		}
+	}
+
+	servers := map[string][]int{}
+	for i, cache := range config.Caches {
+		serves := cache.Serves
+		switch serves {
+		case "", ServesUnified, ServesInstructions, ServesData:
+		default:
+			fail(i, "serves", "unknown accesses %q, expected %s, %s or %s",
+				serves, ServesInstructions, ServesData, ServesUnified)
+			continue
+		}
+		if !isFirstLevel(i) {
+			if serves != "" {
+				fail(i, "serves", "only first-level caches serve accesses, this cache is the next level of another one")
+			}
+			continue
+		}
+		if serves != ServesData {
+			servers[ServesInstructions] = append(servers[ServesInstructions], i)
+		}
+		if serves != ServesInstructions {
+			servers[ServesData] = append(servers[ServesData], i)
+		}
+	}
+
+	for _, accesses := range []string{ServesInstructions, ServesData} {
+		levels := servers[accesses]
+		if len(levels) > 1 {
+			fail(levels[1], "serves", "%s accesses are already served by caches[%d]", accesses, levels[0])
+		} else if len(levels) == 0 && len(config.Caches) > 0 {
+			errs = append(errs, ConfigError{
+				Path:    "caches",
+				Message: fmt.Sprintf("no first-level cache serves %s accesses", accesses),
+			})
+		}
+	}
+	return errs
+}
@@ -5,34 +5,74 @@ package cache
 
 import (
 	"encoding/json"
+	"fmt"
 	"os"
 
 	"github.com/nsengupta5/Cache-Simulator/utils"
 )
 
 // InitializeCaches initializes the caches with the given configuration.
-// It sets the size of the sets, lines, bits and the default policy of
-// the caches.
-func InitializeCaches(config *CacheConfig) {
+// The configuration is validated first, and the problems found are
+// returned without initializing anything, as an invalid configuration
+// could make the simulator panic or loop forever. Otherwise, it gives every
+// core its own private caches and sets the coherence protocol and directory
+// keeping them coherent, then sets the associativity, the size of the sets,
+// lines, bits, the default policy, the write policies, the prefetcher and
+// the victim cache of the caches.
+func InitializeCaches(config *CacheConfig) []ConfigError {
+	if errs := config.Validate(); len(errs) > 0 {
+		return errs
+	}
+
+	if config.AddressBits == 0 {
+		config.AddressBits = DefaultAddressBits
+	}
+	config.SetCores()
+	config.SetInclusion()
+	config.SetHierarchy()
+	config.SetCoherence()
+	config.SetDirectory()
+
 	for i := range config.Caches {
 		cache := &config.Caches[i]
+		cache.SetAssociativity()
 		cache.SetSetsSize()
 		cache.SetLinesSize()
-		cache.SetBitsSize()
+		cache.SetBitsSize(config.AddressBits)
 		cache.SetDefaultPolicy()
+		cache.SetWritePolicies()
+		cache.SetPrefetcher()
+		cache.SetVictimCache(config.AddressBits)
+		if config.ClassifyMisses {
+			cache.SetMissClassifier()
+		}
 	}
+	return nil
 }
 
 // InitializeConfig initializes the cache configuration with the given
 // configuration file. It reads the JSON config file and unmarshals
 // the data into the CacheConfig struct.
 func InitializeConfig(configFile string) CacheConfig {
-	cacheData, err := os.ReadFile(configFile)
+	config, err := LoadConfig(configFile)
 	utils.Check(err)
+	return config
+}
 
+// LoadConfig reads the JSON config file and unmarshals the data into the
+// CacheConfig struct. Unlike InitializeConfig, it returns an error if the
+// file can't be read or isn't valid JSON.
+func LoadConfig(configFile string) (CacheConfig, error) {
 	var config CacheConfig
-	err = json.Unmarshal(cacheData, &config)
-	utils.Check(err)
 
-	return config
+	cacheData, err := os.ReadFile(configFile)
+	if err != nil {
+		return config, err
+	}
+
+	if err = json.Unmarshal(cacheData, &config); err != nil {
+		return config, fmt.Errorf("%s: %w", configFile, err)
+	}
+
+	return config, nil
 }
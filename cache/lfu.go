@@ -4,76 +4,224 @@ package cache
 // cache replacement policy. The LFU policy evicts the least frequently used
 // cache line when the cache is full and a new cache line needs to be inserted.
 // To implement the LFU policy, we keep track of the frequency of each cache
-// line, and evict the cache line with the lowest frequency when necessary.
-// The LFU policy is implemented using the LFU struct, which contains an array
-// of CacheLine structs, and a capacity field to keep track of the maximum
-// number of cache lines that can be stored in the cache.
+// line in a min-heap, so that the victim is found without scanning the set.
+//
+// Plain LFU keeps the frequencies forever, so lines that were hot in an
+// earlier phase of the program are never evicted. The frequencies can be
+// aged in two ways:
+//   - Halving divides every frequency of the set by two after a given
+//     number of accesses to the set.
+//   - Dynamic aging (LFU-DA) keeps an age per set, set to the priority of
+//     the last victim, and gives a line the age plus its reference count
+//     as priority whenever it is inserted or hit, so that the lines that
+//     were hot long ago lose to the lines referenced since.
+//
+// Ties between lines of the same priority are broken by evicting the
+// least recently used line, the line filled the longest time ago, or a
+// random line. The reference counts can saturate at a given number of
+// bits to mimic hardware counters, while the age keeps growing.
+
+import (
+	"container/heap"
+	"math/rand"
+)
+
+// The aging modes of the LFU policy
+const (
+	NoAging      string = "none"
+	HalvingAging string = "halving"
+	DynamicAging string = "dynamic"
+)
+
+// The tie-breaks of the LFU policy
+const (
+	LRUTieBreak    string = "lru"
+	FIFOTieBreak   string = "fifo"
+	RandomTieBreak string = "random"
+)
+
+var lfuAgings = []string{NoAging, HalvingAging, DynamicAging}
+var lfuTieBreaks = []string{LRUTieBreak, FIFOTieBreak, RandomTieBreak}
+
+// The default parameters of the LFU policy
+const (
+	defaultAgingInterval int = 1024
+	defaultCounterBits   int = 0 // Counters don't saturate
+)
+
+// The lfuEntry struct holds the reference count and the priority of the
+// line in a way of the set
+type lfuEntry struct {
+	way      int
+	count    uint64 // The references to the line, saturating at the counter width
+	priority uint64 // The count, plus the age of the set at the last reference with dynamic aging
+	key      uint64 // Breaks ties between lines of the same priority
+	pos      int    // The position of the entry in the heap, -1 if not in it
+}
+
+// The lfuHeap type orders the entries by priority, then by tie-break key
+type lfuHeap []*lfuEntry
+
+func (h lfuHeap) Len() int { return len(h) }
+
+func (h lfuHeap) Less(i, j int) bool {
+	if h[i].priority != h[j].priority {
+		return h[i].priority < h[j].priority
+	}
+	return h[i].key < h[j].key
+}
+
+func (h lfuHeap) Swap(i, j int) {
+	h[i], h[j] = h[j], h[i]
+	h[i].pos = i
+	h[j].pos = j
+}
+
+func (h *lfuHeap) Push(x interface{}) {
+	entry := x.(*lfuEntry)
+	entry.pos = len(*h)
+	*h = append(*h, entry)
+}
+
+func (h *lfuHeap) Pop() interface{} {
+	old := *h
+	entry := old[len(old)-1]
+	entry.pos = -1
+	*h = old[:len(old)-1]
+	return entry
+}
 
 type LFU struct {
-	lines    []CacheLine
-	capacity int
+	entries       []lfuEntry
+	heap          lfuHeap
+	aging         string
+	agingInterval int
+	tieBreak      string
+	maxCount      uint64
+	age           uint64 // The priority of the last victim, for dynamic aging
+	accesses      int    // The accesses to the set since the last halving
+	clock         uint64 // Orders the accesses to the set, for the tie-breaks
+	rng           *rand.Rand
 }
 
-func NewLFU(capacity int) *LFU {
+// NewLFU creates an LFU policy drawing the random tie-breaks from the
+// given random number generator
+func NewLFU(capacity int, params PolicyParams, rng *rand.Rand) *LFU {
+	maxCount := ^uint64(0)
+	if bits := params.Int("counter_bits", defaultCounterBits); bits > 0 {
+		maxCount = 1<<bits - 1
+	}
+
+	entries := make([]lfuEntry, capacity)
+	for i := range entries {
+		entries[i] = lfuEntry{way: i, pos: -1}
+	}
 	return &LFU{
-		lines:    make([]CacheLine, capacity), // Holds the cache lines
-		capacity: capacity,                    // Maximum number of cache lines
+		entries:       entries,
+		heap:          make(lfuHeap, 0, capacity),
+		aging:         params.String("aging", NoAging),
+		agingInterval: params.Int("aging_interval", defaultAgingInterval),
+		tieBreak:      params.String("tie_break", LRUTieBreak),
+		maxCount:      maxCount,
+		rng:           rng,
 	}
 }
 
-// Insert a cache line into the cache
-func (lfu *LFU) Insert(line *CacheLine) {
-	// Keep track of the index of the cache line with the
-	// lowest frequency, and the lowest frequency itself
-	minFreqIndex := -1
-	minFreq := int(^uint(0) >> 1)
-	for i, l := range lfu.lines {
-		// If the line is not valid, update the index and break
-		if !l.Valid {
-			minFreqIndex = i
-			break
-			// If the line is valid and its frequency is less than the
-			// current minimum frequency, update the minimum frequency
-		} else if l.Freq < minFreq {
-			minFreq = l.Freq
-			minFreqIndex = i
-		}
-	}
-
-	// Insert the line at the index of the cache line
-	// with the lowest frequency
-	if minFreqIndex != -1 {
-		lfu.lines[minFreqIndex] = *line
+// Insert a cache line into the cache with a reference count of one
+func (lfu *LFU) Insert(line *CacheLine, access Access) {
+	lfu.tick()
+	entry := &lfu.entries[line.Index]
+	if entry.pos >= 0 {
+		heap.Remove(&lfu.heap, entry.pos)
 	}
+
+	entry.count = 1
+	entry.priority = lfu.priority(entry.count)
+	entry.key = lfu.clock
+	heap.Push(&lfu.heap, entry)
 }
 
-// Update the frequency of a cache line when it is accessed
-func (lfu *LFU) Update(line *CacheLine) {
-	for i, l := range lfu.lines {
-		if l.Tag == line.Tag && l.Valid {
-			lfu.lines[i].Freq++
-			break
-		}
+// Update the reference count and the priority of a cache line when it is
+// accessed
+func (lfu *LFU) Update(line *CacheLine, access Access) {
+	lfu.tick()
+	entry := &lfu.entries[line.Index]
+	if entry.pos < 0 {
+		return
 	}
+
+	if entry.count < lfu.maxCount {
+		entry.count++
+	}
+	entry.priority = lfu.priority(entry.count)
+	if lfu.tieBreak == LRUTieBreak {
+		entry.key = lfu.clock
+	}
+	heap.Fix(&lfu.heap, entry.pos)
 }
 
-// Evict identifies the cache line with the lowest frequency
+// Evict identifies the cache line with the lowest priority
 // It returns the index of the cache line to be evicted
-func (lfu *LFU) Evict() int {
-	minFreqIndex := -1
-	minFreq := int(^uint(0) >> 1)
-	for i, l := range lfu.lines {
-		if l.Valid && l.Freq < minFreq {
-			minFreq = l.Freq
-			minFreqIndex = i
-		}
-	}
-	if minFreqIndex != -1 {
-		evictedIndex := lfu.lines[minFreqIndex].Index
-		lfu.lines[minFreqIndex].Valid = false // Mark as evicted
-		return evictedIndex
-	}
-
-	// Indicate no eviction occurred (should not happen if cache is full)
-	return -1
+func (lfu *LFU) Evict(access Access) int {
+	pos := 0
+	if lfu.tieBreak == RandomTieBreak {
+		ties := lfu.leastFrequent(0, nil)
+		pos = ties[lfu.rng.Intn(len(ties))]
+	}
+
+	entry := heap.Remove(&lfu.heap, pos).(*lfuEntry)
+	if lfu.aging == DynamicAging {
+		lfu.age = entry.priority
+	}
+	return entry.way
+}
+
+// Remove forgets a cache line that has been invalidated
+func (lfu *LFU) Remove(line *CacheLine) {
+	entry := &lfu.entries[line.Index]
+	if entry.pos >= 0 {
+		heap.Remove(&lfu.heap, entry.pos)
+	}
+}
+
+// leastFrequent appends the positions of the heap holding the lowest
+// priority, visiting the subtree rooted at the given position
+func (lfu *LFU) leastFrequent(pos int, ties []int) []int {
+	if pos >= len(lfu.heap) || lfu.heap[pos].priority != lfu.heap[0].priority {
+		return ties
+	}
+	ties = append(ties, pos)
+	ties = lfu.leastFrequent(2*pos+1, ties)
+	return lfu.leastFrequent(2*pos+2, ties)
+}
+
+// tick counts an access to the set, halving every reference count once
+// the aging interval has elapsed
+func (lfu *LFU) tick() {
+	lfu.clock++
+	if lfu.aging != HalvingAging {
+		return
+	}
+
+	lfu.accesses++
+	if lfu.accesses < lfu.agingInterval {
+		return
+	}
+	lfu.accesses = 0
+	for _, entry := range lfu.heap {
+		entry.count /= 2
+		entry.priority = lfu.priority(entry.count)
+	}
+	// Halving keeps the order of the counts, but not the order of the
+	// tie-break keys between counts that become equal
+	heap.Init(&lfu.heap)
+}
+
+// priority returns the priority of a line with the given reference count,
+// referenced now
+func (lfu *LFU) priority(count uint64) uint64 {
+	if lfu.aging == DynamicAging {
+		return lfu.age + count
+	}
+	return count
 }
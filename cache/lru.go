@@ -13,19 +13,20 @@ package cache
 
 type LRU struct {
 	capacity   int
-	cache      map[int]*CacheLine // Maps tags to pointers to cache lines
-	head, tail *CacheLine         // Pointers to head and tail of the doubly-linked list
+	cache      map[uint64]*CacheLine // Maps tags to pointers to cache lines
+	head, tail *CacheLine            // Pointers to head and tail of the doubly-linked list
+	insertion  *insertionPolicy      // Where new lines are inserted, nil for the MRU position
 }
 
 func NewLRU(capacity int) *LRU {
 	return &LRU{
 		capacity: capacity,
-		cache:    make(map[int]*CacheLine),
+		cache:    make(map[uint64]*CacheLine),
 	}
 }
 
 // Insert inserts a new cache line
-func (lru *LRU) Insert(line *CacheLine) {
+func (lru *LRU) Insert(line *CacheLine, access Access) {
 	if existingLine, exists := lru.cache[line.Tag]; exists {
 		// Move the accessed line to the front of the list
 		lru.remove(existingLine)
@@ -33,14 +34,19 @@ func (lru *LRU) Insert(line *CacheLine) {
 		return
 	}
 
-	// Insert the new cache line at the front of the list
+	// Insert the new cache line at the front of the list, unless the
+	// insertion policy puts it at the back
 	lru.cache[line.Tag] = line
-	lru.addToFront(line)
+	if lru.insertion == nil || lru.insertion.atMRU() {
+		lru.addToFront(line)
+	} else {
+		lru.addToBack(line)
+	}
 }
 
 // Update moves the accessed cache line to the front of the list,
 // marking it as most recently used
-func (lru *LRU) Update(line *CacheLine) {
+func (lru *LRU) Update(line *CacheLine, access Access) {
 	if existingLine, exists := lru.cache[line.Tag]; exists {
 		lru.remove(existingLine)
 		lru.addToFront(existingLine)
@@ -48,7 +54,7 @@ func (lru *LRU) Update(line *CacheLine) {
 }
 
 // Evict returns the index of the least recently used cache line
-func (lru *LRU) Evict() int {
+func (lru *LRU) Evict(access Access) int {
 	if lru.tail == nil {
 		return -1 // Cache is empty
 	}
@@ -61,6 +67,14 @@ func (lru *LRU) Evict() int {
 	return evictedIndex
 }
 
+// Remove forgets a cache line that has been invalidated
+func (lru *LRU) Remove(line *CacheLine) {
+	if existingLine, exists := lru.cache[line.Tag]; exists {
+		delete(lru.cache, line.Tag)
+		lru.remove(existingLine)
+	}
+}
+
 // remove removes a cache line from the doubly-linked list
 func (lru *LRU) remove(line *CacheLine) {
 	if line.Prev != nil {
@@ -87,3 +101,17 @@ func (lru *LRU) addToFront(line *CacheLine) {
 		lru.tail = line
 	}
 }
+
+// addToBack adds a cache line to the back of the doubly-linked list,
+// making it the next line to be evicted
+func (lru *LRU) addToBack(line *CacheLine) {
+	line.Prev = lru.tail
+	line.Next = nil
+	if lru.tail != nil {
+		lru.tail.Next = line
+	}
+	lru.tail = line
+	if lru.head == nil {
+		lru.head = line
+	}
+}
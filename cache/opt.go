@@ -0,0 +1,109 @@
+package cache
+
+// This file contains the implementation of Bélády's optimal (OPT/MIN)
+// replacement policy. The OPT policy evicts the line that will be used
+// furthest in the future, which gives the lowest possible miss rate and
+// serves as an upper bound when judging other policies. Since the future
+// accesses can't be known while the trace is running, the simulator does
+// a pre-pass over the trace and records the times at which every line is
+// accessed in an oracle. When a line has to be evicted, the oracle is
+// asked for the next use of every line of the set after the current
+// access. The next uses are taken from the whole trace, so for the lower
+// levels of a hierarchy they ignore the filtering done by the levels above.
+
+import (
+	"math"
+	"sort"
+)
+
+// The Oracle struct holds the times at which every line of the trace
+// is accessed, for lines of the given size
+type Oracle struct {
+	lineSize uint64
+	uses     map[uint64][]uint64 // Maps line addresses to their access times
+}
+
+func NewOracle(lineSize int) *Oracle {
+	return &Oracle{
+		lineSize: uint64(lineSize),
+		uses:     make(map[uint64][]uint64),
+	}
+}
+
+// LineSize returns the size of the lines recorded by the oracle
+func (o *Oracle) LineSize() int {
+	return int(o.lineSize)
+}
+
+// Record records an access of size bytes starting at the given address
+// at the given time. Accesses must be recorded in the order of the trace.
+func (o *Oracle) Record(time uint64, address uint64, size int) {
+	end := address + uint64(size)
+	for lineAddress := address &^ (o.lineSize - 1); lineAddress < end; lineAddress += o.lineSize {
+		uses := o.uses[lineAddress]
+		if len(uses) == 0 || uses[len(uses)-1] != time {
+			o.uses[lineAddress] = append(uses, time)
+		}
+	}
+}
+
+// Share makes the oracle use the accesses recorded by another oracle
+// with the same line size, so the trace is only recorded once
+func (o *Oracle) Share(other *Oracle) {
+	o.uses = other.uses
+}
+
+// NextUse returns the time of the first access to the line at the given
+// address after the given time, or math.MaxUint64 if it isn't used again
+func (o *Oracle) NextUse(lineAddress uint64, time uint64) uint64 {
+	uses := o.uses[lineAddress]
+	i := sort.Search(len(uses), func(i int) bool { return uses[i] > time })
+	if i == len(uses) {
+		return math.MaxUint64
+	}
+	return uses[i]
+}
+
+type OPT struct {
+	oracle    *Oracle
+	addresses []uint64 // The address of the line held in each slot
+}
+
+func NewOPT(capacity int, oracle *Oracle) *OPT {
+	return &OPT{
+		oracle:    oracle,
+		addresses: make([]uint64, capacity),
+	}
+}
+
+// Insert records the address of the line held in the slot
+func (opt *OPT) Insert(line *CacheLine, access Access) {
+	opt.addresses[line.Index] = access.Address
+}
+
+// No action required to update a line, as the decision only depends
+// on future accesses
+func (opt *OPT) Update(line *CacheLine, access Access) {
+}
+
+// Evict returns the index of the line used furthest in the future
+func (opt *OPT) Evict(access Access) int {
+	evictIndex := 0
+	var furthest uint64
+	for i, address := range opt.addresses {
+		nextUse := opt.oracle.NextUse(address, access.Time)
+		if nextUse > furthest {
+			furthest = nextUse
+			evictIndex = i
+		}
+		if nextUse == math.MaxUint64 {
+			break
+		}
+	}
+	return evictIndex
+}
+
+// No action required to remove a line, its slot is reused by the
+// next insertion
+func (opt *OPT) Remove(line *CacheLine) {
+}
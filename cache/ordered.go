@@ -0,0 +1,64 @@
+package cache
+
+// This file contains the ordered set used by the policies that keep lines
+// or the addresses of evicted lines in recency or insertion order, such
+// as the ghost lists of ARC and 2Q. Keys are pushed to the front, and the
+// oldest key is at the back.
+
+import "container/list"
+
+type orderedSet struct {
+	order    *list.List
+	elements map[uint64]*list.Element
+}
+
+func newOrderedSet() *orderedSet {
+	return &orderedSet{
+		order:    list.New(),
+		elements: make(map[uint64]*list.Element),
+	}
+}
+
+// len returns the number of keys in the set
+func (s *orderedSet) len() int {
+	return s.order.Len()
+}
+
+// contains returns true if the key is in the set
+func (s *orderedSet) contains(key uint64) bool {
+	_, ok := s.elements[key]
+	return ok
+}
+
+// pushFront adds the key to the front of the set, moving it there if it
+// is already in the set
+func (s *orderedSet) pushFront(key uint64) {
+	if element, ok := s.elements[key]; ok {
+		s.order.MoveToFront(element)
+		return
+	}
+	s.elements[key] = s.order.PushFront(key)
+}
+
+// remove removes the key from the set, returning true if it was in it
+func (s *orderedSet) remove(key uint64) bool {
+	element, ok := s.elements[key]
+	if !ok {
+		return false
+	}
+	s.order.Remove(element)
+	delete(s.elements, key)
+	return true
+}
+
+// popBack removes and returns the oldest key of the set. It returns false
+// if the set is empty.
+func (s *orderedSet) popBack() (uint64, bool) {
+	back := s.order.Back()
+	if back == nil {
+		return 0, false
+	}
+	key := back.Value.(uint64)
+	s.remove(key)
+	return key, true
+}
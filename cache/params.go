@@ -0,0 +1,83 @@
+package cache
+
+// This file contains the parameters of the replacement policies. The
+// parameters are given in the policy_params object of a cache in the JSON
+// config, and each policy reads the ones it needs, falling back to its
+// defaults for the missing ones.
+
+import (
+	"fmt"
+	"strings"
+)
+
+// The PolicyParams type holds the parameters of a replacement policy
+type PolicyParams map[string]interface{}
+
+// Int returns the integer parameter with the given name, or the
+// default value if it isn't given
+func (params PolicyParams) Int(name string, def int) int {
+	if value, ok := params[name].(float64); ok {
+		return int(value)
+	}
+	return def
+}
+
+// Float returns the numeric parameter with the given name, or the
+// default value if it isn't given
+func (params PolicyParams) Float(name string, def float64) float64 {
+	if value, ok := params[name].(float64); ok {
+		return value
+	}
+	return def
+}
+
+// String returns the string parameter with the given name, or the
+// default value if it isn't given
+func (params PolicyParams) String(name string, def string) string {
+	if value, ok := params[name].(string); ok {
+		return value
+	}
+	return def
+}
+
+// CheckInt returns an error if the parameter with the given name is
+// given but isn't an integer between min and max
+func (params PolicyParams) CheckInt(name string, min int, max int) error {
+	value, exists := params[name]
+	if !exists {
+		return nil
+	}
+	number, ok := value.(float64)
+	if !ok || number != float64(int(number)) || int(number) < min || int(number) > max {
+		return fmt.Errorf("must be an integer between %d and %d, got %v", min, max, value)
+	}
+	return nil
+}
+
+// CheckFloat returns an error if the parameter with the given name is
+// given but isn't a number between min and max
+func (params PolicyParams) CheckFloat(name string, min float64, max float64) error {
+	value, exists := params[name]
+	if !exists {
+		return nil
+	}
+	number, ok := value.(float64)
+	if !ok || number < min || number > max {
+		return fmt.Errorf("must be a number between %g and %g, got %v", min, max, value)
+	}
+	return nil
+}
+
+// CheckString returns an error if the parameter with the given name is
+// given but isn't one of the given values
+func (params PolicyParams) CheckString(name string, values []string) error {
+	value, exists := params[name]
+	if !exists {
+		return nil
+	}
+	str, ok := value.(string)
+	if !ok || !contains(values, str) {
+		return fmt.Errorf("must be one of %s, got %v", strings.Join(values, ", "), value)
+	}
+	return nil
+}
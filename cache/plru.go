@@ -0,0 +1,160 @@
+package cache
+
+// This file contains the implementation of the pseudo-LRU (PLRU)
+// replacement policies, which approximate LRU with a few bits per set
+// as real hardware does for highly associative caches.
+//   - Tree-PLRU arranges the ways as the leaves of a binary tree, with one
+//     bit per internal node pointing towards the half of the tree holding
+//     the pseudo least recently used line. An access flips the bits on its
+//     path to point away from it, and the victim is found by following the
+//     bits from the root. Non power of two associativities are handled by
+//     never following a bit towards a subtree without any ways.
+//   - Bit-PLRU (also known as MRU-bit) keeps one bit per way which is set
+//     when the way is accessed. Once every bit is set, all the bits but
+//     the one of the accessed way are cleared. The victim is the first
+//     way whose bit is clear.
+
+// The bitVector type is a fixed size vector of bits
+type bitVector []uint64
+
+func newBitVector(size int) bitVector {
+	return make(bitVector, (size+63)/64)
+}
+
+// get returns the value of the bit at position i
+func (bv bitVector) get(i int) bool {
+	return bv[i/64]&(1<<(i%64)) != 0
+}
+
+// set sets the bit at position i to the given value
+func (bv bitVector) set(i int, value bool) {
+	if value {
+		bv[i/64] |= 1 << (i % 64)
+	} else {
+		bv[i/64] &^= 1 << (i % 64)
+	}
+}
+
+/* ------------------- Tree-PLRU ------------------- */
+
+type TreePLRU struct {
+	capacity int
+	leaves   int       // The number of leaves, the next power of two of the capacity
+	bits     bitVector // One bit per internal node, set if the victim is on the right
+}
+
+func NewTreePLRU(capacity int) *TreePLRU {
+	leaves := 1
+	for leaves < capacity {
+		leaves *= 2
+	}
+	return &TreePLRU{
+		capacity: capacity,
+		leaves:   leaves,
+		bits:     newBitVector(leaves),
+	}
+}
+
+// Insert marks the inserted line as most recently used
+func (plru *TreePLRU) Insert(line *CacheLine, access Access) {
+	plru.touch(line.Index)
+}
+
+// Update marks the accessed line as most recently used
+func (plru *TreePLRU) Update(line *CacheLine, access Access) {
+	plru.touch(line.Index)
+}
+
+// Evict follows the bits from the root to the pseudo least recently used line
+func (plru *TreePLRU) Evict(access Access) int {
+	node, low, high := 0, 0, plru.leaves
+	for high-low > 1 {
+		mid := (low + high) / 2
+		// A subtree without any ways can't hold the victim
+		if plru.bits.get(node) && mid < plru.capacity {
+			node, low = 2*node+2, mid
+		} else {
+			node, high = 2*node+1, mid
+		}
+	}
+	return low
+}
+
+// No action required to remove a line, invalid lines are always
+// replaced first
+func (plru *TreePLRU) Remove(line *CacheLine) {
+}
+
+// touch flips the bits on the path to the given way to point away from it
+func (plru *TreePLRU) touch(way int) {
+	node, low, high := 0, 0, plru.leaves
+	for high-low > 1 {
+		mid := (low + high) / 2
+		if way < mid {
+			plru.bits.set(node, true)
+			node, high = 2*node+1, mid
+		} else {
+			plru.bits.set(node, false)
+			node, low = 2*node+2, mid
+		}
+	}
+}
+
+/* ------------------- Bit-PLRU ------------------- */
+
+type BitPLRU struct {
+	capacity int
+	mru      bitVector // One bit per way, set if the way was recently used
+	count    int       // The number of bits set
+}
+
+func NewBitPLRU(capacity int) *BitPLRU {
+	return &BitPLRU{
+		capacity: capacity,
+		mru:      newBitVector(capacity),
+	}
+}
+
+// Insert marks the inserted line as recently used
+func (plru *BitPLRU) Insert(line *CacheLine, access Access) {
+	plru.touch(line.Index)
+}
+
+// Update marks the accessed line as recently used
+func (plru *BitPLRU) Update(line *CacheLine, access Access) {
+	plru.touch(line.Index)
+}
+
+// Evict returns the first way that wasn't recently used
+func (plru *BitPLRU) Evict(access Access) int {
+	for i := 0; i < plru.capacity; i++ {
+		if !plru.mru.get(i) {
+			return i
+		}
+	}
+	return 0
+}
+
+// Remove clears the bit of an invalidated line
+func (plru *BitPLRU) Remove(line *CacheLine) {
+	if plru.mru.get(line.Index) {
+		plru.mru.set(line.Index, false)
+		plru.count--
+	}
+}
+
+// touch sets the bit of the given way, clearing the others once they
+// would all be set
+func (plru *BitPLRU) touch(way int) {
+	if plru.mru.get(way) {
+		return
+	}
+	if plru.count == plru.capacity-1 {
+		for i := range plru.mru {
+			plru.mru[i] = 0
+		}
+		plru.count = 0
+	}
+	plru.mru.set(way, true)
+	plru.count++
+}
@@ -0,0 +1,134 @@
+package cache
+
+// This file contains the pieces shared by the PC-based replacement
+// policies, SHiP and Hawkeye. Both predict whether the lines brought in
+// by an instruction will be reused, with a table of saturating counters
+// indexed by a hash of the PC of the instruction. The predictions are
+// checked against the actual outcome, and the accuracy is kept for every
+// PC so that the instructions the predictor gets wrong can be found.
+
+import (
+	"fmt"
+	"sort"
+)
+
+// The default parameters of the PC-based predictors
+const (
+	defaultPCCounterBits int = 3
+	defaultPCStats       int = 32
+)
+
+// The counterTable type is a table of saturating counters indexed by PC
+type counterTable struct {
+	counters []int
+	max      int
+}
+
+// newCounterTable creates a table of 2^indexBits counters of the given
+// width, all starting at the given value
+func newCounterTable(indexBits int, counterBits int, initial int) *counterTable {
+	table := &counterTable{
+		counters: make([]int, 1<<indexBits),
+		max:      1<<counterBits - 1,
+	}
+	for i := range table.counters {
+		table.counters[i] = initial
+	}
+	return table
+}
+
+// index hashes a PC into the table by folding its bits
+func (table *counterTable) index(pc uint64) int {
+	size := uint64(len(table.counters))
+	var hash uint64
+	for pc > 0 {
+		hash ^= pc % size
+		pc /= size
+	}
+	return int(hash)
+}
+
+// get returns the counter of the PC
+func (table *counterTable) get(pc uint64) int {
+	return table.counters[table.index(pc)]
+}
+
+// increment increments the counter of the PC unless it is saturated
+func (table *counterTable) increment(pc uint64) {
+	if i := table.index(pc); table.counters[i] < table.max {
+		table.counters[i]++
+	}
+}
+
+// decrement decrements the counter of the PC unless it is zero
+func (table *counterTable) decrement(pc uint64) {
+	if i := table.index(pc); table.counters[i] > 0 {
+		table.counters[i]--
+	}
+}
+
+// The pcAccuracy struct counts the correct predictions made for each PC
+type pcAccuracy struct {
+	predictions map[uint64]uint64
+	correct     map[uint64]uint64
+	limit       int // The number of PCs reported, 0 to report all of them
+}
+
+func newPCAccuracy(limit int) *pcAccuracy {
+	return &pcAccuracy{
+		predictions: make(map[uint64]uint64),
+		correct:     make(map[uint64]uint64),
+		limit:       limit,
+	}
+}
+
+// record counts a prediction made for the PC
+func (acc *pcAccuracy) record(pc uint64, correct bool) {
+	acc.predictions[pc]++
+	if correct {
+		acc.correct[pc]++
+	}
+}
+
+// stats returns the overall accuracy of the predictions, and the accuracy
+// for the PCs with the most predictions
+func (acc *pcAccuracy) stats() map[string]interface{} {
+	pcs := make([]uint64, 0, len(acc.predictions))
+	var predictions, correct uint64
+	for pc, n := range acc.predictions {
+		pcs = append(pcs, pc)
+		predictions += n
+		correct += acc.correct[pc]
+	}
+	sort.Slice(pcs, func(i, j int) bool {
+		if acc.predictions[pcs[i]] != acc.predictions[pcs[j]] {
+			return acc.predictions[pcs[i]] > acc.predictions[pcs[j]]
+		}
+		return pcs[i] < pcs[j]
+	})
+	if acc.limit > 0 && len(pcs) > acc.limit {
+		pcs = pcs[:acc.limit]
+	}
+
+	pcStats := []map[string]interface{}{}
+	for _, pc := range pcs {
+		pcStats = append(pcStats, map[string]interface{}{
+			"pc":          fmt.Sprintf("%x", pc),
+			"predictions": acc.predictions[pc],
+			"accuracy":    ratio(acc.correct[pc], acc.predictions[pc]),
+		})
+	}
+	return map[string]interface{}{
+		"predictions": predictions,
+		"accuracy":    ratio(correct, predictions),
+		"pcs":         pcStats,
+	}
+}
+
+// ratio returns a / b, or 0 if b is 0
+func ratio(a uint64, b uint64) float64 {
+	if b == 0 {
+		return 0
+	}
+	return float64(a) / float64(b)
+}
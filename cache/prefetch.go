@@ -0,0 +1,171 @@
+package cache
+
+// This file contains the prefetchers that can be attached to any cache.
+// A prefetcher observes the demand accesses of its cache and predicts the
+// lines that will be accessed next, so that they can be brought into the
+// cache before they are needed. Two prefetchers are implemented:
+//   - The next-line prefetcher fetches the N lines following a missing line
+//   - The stride prefetcher keeps a table indexed by the PC of the access,
+//     recording the last address and stride of each instruction. Once the
+//     same stride has been seen enough times, it fetches the next N lines
+//     along the stride.
+
+import "fmt"
+
+// The Prefetcher interface is a contract for implementing different
+// prefetchers for the cache
+type Prefetcher interface {
+	// Access observes a demand access of the instruction at pc to the
+	// given address. It returns the addresses to prefetch.
+	Access(pc uint64, address uint64, hit bool) []uint64
+}
+
+// The kinds of prefetchers that can be attached to a cache
+const (
+	NextLinePrefetcher string = "next_line"
+	StridePrefetcher   string = "stride"
+)
+
+// The PrefetcherConfig struct represents the configuration of the
+// prefetcher of a cache
+type PrefetcherConfig struct {
+	Kind      string `json:"kind"`       // The kind of prefetcher
+	Degree    int    `json:"degree"`     // The number of lines prefetched at a time
+	TableSize int    `json:"table_size"` // The number of entries of the stride table
+	Latency   int    `json:"latency"`    // The number of instructions before a prefetch completes
+}
+
+// The default configuration of the prefetchers
+const (
+	defaultPrefetchDegree  int = 1
+	defaultStrideTableSize int = 64
+)
+
+// NewPrefetcher creates the prefetcher described by the given
+// configuration for a cache with the given line size
+func NewPrefetcher(config PrefetcherConfig, lineSize int) (Prefetcher, error) {
+	degree := config.Degree
+	if degree == 0 {
+		degree = defaultPrefetchDegree
+	}
+
+	switch config.Kind {
+	case NextLinePrefetcher:
+		return NewNextLine(degree, lineSize), nil
+	case StridePrefetcher:
+		tableSize := config.TableSize
+		if tableSize == 0 {
+			tableSize = defaultStrideTableSize
+		}
+		return NewStride(degree, tableSize, lineSize), nil
+	default:
+		return nil, fmt.Errorf(
+			"unknown prefetcher %q, expected %s or %s",
+			config.Kind, NextLinePrefetcher, StridePrefetcher,
+		)
+	}
+}
+
+/* ------------------- Next-Line Prefetcher ------------------- */
+
+type NextLine struct {
+	degree   int
+	lineSize uint64
+}
+
+func NewNextLine(degree int, lineSize int) *NextLine {
+	return &NextLine{
+		degree:   degree,
+		lineSize: uint64(lineSize),
+	}
+}
+
+// Access returns the lines following the accessed line on a miss
+func (nl *NextLine) Access(pc uint64, address uint64, hit bool) []uint64 {
+	if hit {
+		return nil
+	}
+
+	addresses := make([]uint64, nl.degree)
+	for i := range addresses {
+		addresses[i] = address + uint64(i+1)*nl.lineSize
+	}
+	return addresses
+}
+
+/* ------------------- Stride Prefetcher ------------------- */
+
+// The confidence needed before the stride prefetcher issues prefetches,
+// and the maximum confidence of an entry
+const (
+	strideThreshold     int = 2
+	strideMaxConfidence int = 3
+)
+
+// The strideEntry struct represents the last access of an instruction
+type strideEntry struct {
+	valid       bool
+	pc          uint64
+	lastAddress uint64
+	stride      int64
+	confidence  int
+}
+
+type Stride struct {
+	table    []strideEntry
+	degree   int
+	lineSize int64
+}
+
+func NewStride(degree int, tableSize int, lineSize int) *Stride {
+	return &Stride{
+		table:    make([]strideEntry, tableSize),
+		degree:   degree,
+		lineSize: int64(lineSize),
+	}
+}
+
+// Access updates the table entry of the instruction and returns the next
+// addresses along its stride once the stride is confirmed
+func (sp *Stride) Access(pc uint64, address uint64, hit bool) []uint64 {
+	entry := &sp.table[pc%uint64(len(sp.table))]
+
+	// A new instruction replaces the entry, its stride isn't known yet
+	if !entry.valid || entry.pc != pc {
+		*entry = strideEntry{valid: true, pc: pc, lastAddress: address}
+		return nil
+	}
+
+	stride := int64(address - entry.lastAddress)
+	entry.lastAddress = address
+	if stride == entry.stride && stride != 0 {
+		if entry.confidence < strideMaxConfidence {
+			entry.confidence++
+		}
+	} else {
+		if entry.confidence > 0 {
+			entry.confidence--
+		}
+		if entry.confidence == 0 {
+			entry.stride = stride
+		}
+	}
+
+	if entry.confidence < strideThreshold {
+		return nil
+	}
+
+	// Strides smaller than a line would prefetch the same line repeatedly
+	step := entry.stride
+	if step > 0 && step < sp.lineSize {
+		step = sp.lineSize
+	} else if step < 0 && step > -sp.lineSize {
+		step = -sp.lineSize
+	}
+
+	addresses := make([]uint64, sp.degree)
+	for i := range addresses {
+		addresses[i] = address + uint64(int64(i+1)*step)
+	}
+	return addresses
+}
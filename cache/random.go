@@ -0,0 +1,38 @@
+package cache
+
+// This file implements the Random replacement policy
+// The Random policy evicts a line of the set chosen uniformly at random.
+// The random numbers are drawn from a generator seeded with the seed of
+// the cache, so that runs are reproducible and different seeds can be
+// compared.
+
+import "math/rand"
+
+type Random struct {
+	capacity int
+	rng      *rand.Rand
+}
+
+func NewRandom(capacity int, rng *rand.Rand) *Random {
+	return &Random{
+		capacity: capacity,
+		rng:      rng,
+	}
+}
+
+// No action required to insert a line
+func (r *Random) Insert(line *CacheLine, access Access) {
+}
+
+// No action required to update a line
+func (r *Random) Update(line *CacheLine, access Access) {
+}
+
+// Evict returns the index of a random line of the set
+func (r *Random) Evict(access Access) int {
+	return r.rng.Intn(r.capacity)
+}
+
+// No action required to remove a line
+func (r *Random) Remove(line *CacheLine) {
+}
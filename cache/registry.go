@@ -0,0 +1,304 @@
+package cache
+
+// This file contains the registry of replacement policies. Every policy
+// is registered under the name used in the replacement_policy field of
+// the JSON config, with a factory creating it for a cache and an optional
+// validator for its policy_params. The built-in policies are registered
+// below, and programs using the cache package as a library can register
+// their own policies the same way, before the configuration is validated
+// and the caches are initialized.
+
+import (
+	"fmt"
+	"math"
+	"math/rand"
+	"sort"
+	"strings"
+)
+
+// A PolicyFactory prepares a replacement policy for a cache, creating the
+// state shared by its sets, and returns the constructor of the policy of
+// each set. The parameters of the policy are in the PolicyParams of the
+// cache, and the shared state can be reported in the output by setting the
+// PolicyState of the cache. Policies making random choices should draw
+// them from the given generator, which is seeded with the seed of the cache.
+type PolicyFactory func(cache *Cache, rng *rand.Rand) SetPolicyConstructor
+
+// A SetPolicyConstructor creates the replacement policy of the set with
+// the given index, holding the given number of lines
+type SetPolicyConstructor func(set int, capacity int) ReplacementPolicy
+
+// A ParamsValidator returns the errors in the parameters of a policy,
+// keyed by the name of the offending parameter. Parameters the policy
+// doesn't know are errors too, so that a misspelled parameter isn't
+// silently replaced by its default.
+type ParamsValidator func(params PolicyParams) map[string]error
+
+type registeredPolicy struct {
+	factory        PolicyFactory
+	validate       ParamsValidator
+	setAssociative bool // Whether the policy needs a set associative cache
+}
+
+var policies = map[string]registeredPolicy{}
+
+// RegisterPolicy makes a replacement policy available under the given
+// name. The validator may be nil if the policy has no parameters, in which
+// case any parameter given to it is rejected.
+// It panics if the name is empty or already registered, or if the factory
+// is nil. Policies must be registered before the caches are initialized,
+// typically from an init function.
+func RegisterPolicy(name string, factory PolicyFactory, validate ParamsValidator) {
+	register(name, registeredPolicy{factory: factory, validate: validate})
+}
+
+// RegisterSetAssociativePolicy makes a replacement policy available under
+// the given name like RegisterPolicy, for policies that need a set
+// associative cache. The lines of a direct-mapped cache are filled without
+// calling the policy, which would put a policy keeping its own lists of
+// the lines out of step with the sets, so such caches reject the policy.
+func RegisterSetAssociativePolicy(name string, factory PolicyFactory, validate ParamsValidator) {
+	register(name, registeredPolicy{factory: factory, validate: validate, setAssociative: true})
+}
+
+// register adds a policy to the registry, checking its name and factory
+func register(name string, policy registeredPolicy) {
+	if name == "" {
+		panic("cache: RegisterPolicy with an empty name")
+	}
+	if policy.factory == nil {
+		panic(fmt.Sprintf("cache: RegisterPolicy %q with a nil factory", name))
+	}
+	if _, exists := policies[name]; exists {
+		panic(fmt.Sprintf("cache: RegisterPolicy called twice for %q", name))
+	}
+	policies[name] = policy
+}
+
+// PolicyNames returns the sorted names of the registered policies
+func PolicyNames() []string {
+	names := make([]string, 0, len(policies))
+	for name := range policies {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// perSet returns a factory for a policy without any state shared by
+// the sets
+func perSet(constructor SetPolicyConstructor) PolicyFactory {
+	return func(cache *Cache, rng *rand.Rand) SetPolicyConstructor {
+		return constructor
+	}
+}
+
+/* ------------------- Built-in Policies ------------------- */
+
+func init() {
+	RegisterPolicy("rr", perSet(func(set int, capacity int) ReplacementPolicy {
+		return NewRR(capacity)
+	}), nil)
+	RegisterPolicy("fifo", perSet(func(set int, capacity int) ReplacementPolicy {
+		return NewFIFO(capacity)
+	}), nil)
+	RegisterPolicy("random", func(cache *Cache, rng *rand.Rand) SetPolicyConstructor {
+		return func(set int, capacity int) ReplacementPolicy {
+			return NewRandom(capacity, rng)
+		}
+	}, nil)
+	RegisterPolicy("lru", perSet(func(set int, capacity int) ReplacementPolicy {
+		return NewLRU(capacity)
+	}), nil)
+	RegisterPolicy("lfu", func(cache *Cache, rng *rand.Rand) SetPolicyConstructor {
+		return func(set int, capacity int) ReplacementPolicy {
+			return NewLFU(capacity, cache.PolicyParams, rng)
+		}
+	}, validateLFU)
+
+	// The optimal policy needs to know the future accesses of every line,
+	// which the simulator records in the oracle before running the trace
+	RegisterPolicy("opt", func(cache *Cache, rng *rand.Rand) SetPolicyConstructor {
+		cache.Oracle = NewOracle(cache.LineSize)
+		return func(set int, capacity int) ReplacementPolicy {
+			return NewOPT(capacity, cache.Oracle)
+		}
+	}, nil)
+
+	RegisterPolicy("plru_tree", perSet(func(set int, capacity int) ReplacementPolicy {
+		return NewTreePLRU(capacity)
+	}), nil)
+	RegisterPolicy("plru_bit", perSet(func(set int, capacity int) ReplacementPolicy {
+		return NewBitPLRU(capacity)
+	}), nil)
+
+	// The CLOCK and NRU policies count the work done on their bits
+	// across the sets
+	RegisterPolicy("clock", func(cache *Cache, rng *rand.Rand) SetPolicyConstructor {
+		stats := &ClockStats{}
+		cache.PolicyState = stats
+		return func(set int, capacity int) ReplacementPolicy {
+			return NewClock(capacity, stats)
+		}
+	}, nil)
+	RegisterPolicy("nru", func(cache *Cache, rng *rand.Rand) SetPolicyConstructor {
+		stats := &NRUStats{}
+		cache.PolicyState = stats
+		return func(set int, capacity int) ReplacementPolicy {
+			return NewNRU(capacity, stats)
+		}
+	}, nil)
+
+	RegisterPolicy("srrip", func(cache *Cache, rng *rand.Rand) SetPolicyConstructor {
+		return func(set int, capacity int) ReplacementPolicy {
+			return NewSRRIP(capacity, cache.PolicyParams)
+		}
+	}, validateSRRIP)
+	RegisterPolicy("brrip", func(cache *Cache, rng *rand.Rand) SetPolicyConstructor {
+		return func(set int, capacity int) ReplacementPolicy {
+			return NewBRRIP(capacity, cache.PolicyParams, rng)
+		}
+	}, validateBRRIP)
+
+	// The dynamic policies share their set dueling state across the sets
+	RegisterPolicy("drrip", func(cache *Cache, rng *rand.Rand) SetPolicyConstructor {
+		dueling := NewSetDuelingFromParams(len(cache.Sets), cache.PolicyParams)
+		cache.PolicyState = dueling
+		return func(set int, capacity int) ReplacementPolicy {
+			return NewDRRIP(capacity, cache.PolicyParams, rng, set, dueling)
+		}
+	}, validateDRRIP)
+
+	RegisterPolicy("lip", perSet(func(set int, capacity int) ReplacementPolicy {
+		return NewLIP(capacity)
+	}), nil)
+	RegisterPolicy("bip", func(cache *Cache, rng *rand.Rand) SetPolicyConstructor {
+		return func(set int, capacity int) ReplacementPolicy {
+			return NewBIP(capacity, cache.PolicyParams, rng)
+		}
+	}, validateBIP)
+	RegisterPolicy("dip", func(cache *Cache, rng *rand.Rand) SetPolicyConstructor {
+		dueling := NewSetDuelingFromParams(len(cache.Sets), cache.PolicyParams)
+		cache.PolicyState = dueling
+		return func(set int, capacity int) ReplacementPolicy {
+			return NewDIP(capacity, cache.PolicyParams, rng, set, dueling)
+		}
+	}, validateDIP)
+
+	// The ARC and 2Q policies count the hits on their ghost lists
+	// across the sets, and keep lists of the lines of each set
+	RegisterSetAssociativePolicy("arc", func(cache *Cache, rng *rand.Rand) SetPolicyConstructor {
+		stats := &ARCStats{}
+		cache.PolicyState = stats
+		return func(set int, capacity int) ReplacementPolicy {
+			return NewARC(capacity, stats)
+		}
+	}, nil)
+	RegisterSetAssociativePolicy("2q", func(cache *Cache, rng *rand.Rand) SetPolicyConstructor {
+		stats := &TwoQStats{}
+		cache.PolicyState = stats
+		return func(set int, capacity int) ReplacementPolicy {
+			return NewTwoQ(capacity, cache.PolicyParams, stats)
+		}
+	}, validateTwoQ)
+
+	// The PC-based policies share their predictor across the sets
+	RegisterPolicy("ship", func(cache *Cache, rng *rand.Rand) SetPolicyConstructor {
+		predictor := NewSHiPPredictor(cache.PolicyParams)
+		cache.PolicyState = predictor
+		return func(set int, capacity int) ReplacementPolicy {
+			return NewSHiP(capacity, cache.PolicyParams, predictor)
+		}
+	}, validateSHiP)
+	RegisterPolicy("hawkeye", func(cache *Cache, rng *rand.Rand) SetPolicyConstructor {
+		predictor := NewHawkeyePredictor(len(cache.Sets), cache.PolicyParams)
+		cache.PolicyState = predictor
+		return func(set int, capacity int) ReplacementPolicy {
+			return NewHawkeye(capacity, set, predictor)
+		}
+	}, validateHawkeye)
+}
+
+/* ------------------- Built-in Validators ------------------- */
+
+// validator returns a ParamsValidator running the given checks, each
+// returning the name of a parameter and its error, if any. The parameters
+// that aren't checked are unknown to the policy, and rejected.
+func validator(checks func(params PolicyParams, check func(name string, err error))) ParamsValidator {
+	return func(params PolicyParams) map[string]error {
+		errs := map[string]error{}
+		known := []string{}
+		checks(params, func(name string, err error) {
+			known = append(known, name)
+			if err != nil {
+				errs[name] = err
+			}
+		})
+
+		sort.Strings(known)
+		for name := range params {
+			if !contains(known, name) {
+				errs[name] = fmt.Errorf("unknown parameter, expected one of %s", strings.Join(known, ", "))
+			}
+		}
+		return errs
+	}
+}
+
+var validateLFU = validator(func(params PolicyParams, check func(string, error)) {
+	check("aging", params.CheckString("aging", lfuAgings))
+	check("aging_interval", params.CheckInt("aging_interval", 1, math.MaxInt32))
+	check("tie_break", params.CheckString("tie_break", lfuTieBreaks))
+	check("counter_bits", params.CheckInt("counter_bits", 1, 63))
+})
+
+var validateSRRIP = validator(func(params PolicyParams, check func(string, error)) {
+	check("rrpv_bits", params.CheckInt("rrpv_bits", 1, 8))
+})
+
+var validateBRRIP = validator(func(params PolicyParams, check func(string, error)) {
+	check("rrpv_bits", params.CheckInt("rrpv_bits", 1, 8))
+	check("epsilon", params.CheckFloat("epsilon", 0, 1))
+})
+
+var validateDRRIP = validator(func(params PolicyParams, check func(string, error)) {
+	check("rrpv_bits", params.CheckInt("rrpv_bits", 1, 8))
+	check("epsilon", params.CheckFloat("epsilon", 0, 1))
+	checkDueling(params, check)
+})
+
+var validateBIP = validator(func(params PolicyParams, check func(string, error)) {
+	check("epsilon", params.CheckFloat("epsilon", 0, 1))
+})
+
+var validateDIP = validator(func(params PolicyParams, check func(string, error)) {
+	check("epsilon", params.CheckFloat("epsilon", 0, 1))
+	checkDueling(params, check)
+})
+
+// checkDueling checks the parameters of the set dueling of the dynamic
+// policies
+func checkDueling(params PolicyParams, check func(string, error)) {
+	check("leader_sets", params.CheckInt("leader_sets", 1, math.MaxInt32))
+	check("psel_bits", params.CheckInt("psel_bits", 1, 30))
+	check("psel_interval", params.CheckInt("psel_interval", 1, math.MaxInt32))
+}
+
+var validateTwoQ = validator(func(params PolicyParams, check func(string, error)) {
+	check("kin", params.CheckFloat("kin", 0, 1))
+	check("kout", params.CheckFloat("kout", 0, 1))
+})
+
+var validateSHiP = validator(func(params PolicyParams, check func(string, error)) {
+	check("shct_bits", params.CheckInt("shct_bits", 1, 24))
+	check("counter_bits", params.CheckInt("counter_bits", 1, 8))
+	check("rrpv_bits", params.CheckInt("rrpv_bits", 1, 8))
+	check("pc_stats", params.CheckInt("pc_stats", 0, math.MaxInt32))
+})
+
+var validateHawkeye = validator(func(params PolicyParams, check func(string, error)) {
+	check("predictor_bits", params.CheckInt("predictor_bits", 1, 24))
+	check("counter_bits", params.CheckInt("counter_bits", 1, 8))
+	check("sampled_sets", params.CheckInt("sampled_sets", 1, math.MaxInt32))
+	check("pc_stats", params.CheckInt("pc_stats", 0, math.MaxInt32))
+})
@@ -0,0 +1,190 @@
+package cache
+
+// This file contains the tests of the registry of replacement policies
+
+import (
+	"math/rand"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+)
+
+// The testPolicy struct is an LRU policy recording the set it was
+// created for
+type testPolicy struct {
+	*LRU
+	set      int
+	capacity int
+}
+
+// The caches the factory of the test policy was called for
+var testPolicyCaches []*Cache
+
+func init() {
+	// A policy registered by a library, with a parameter
+	RegisterPolicy("test_policy", func(cache *Cache, rng *rand.Rand) SetPolicyConstructor {
+		testPolicyCaches = append(testPolicyCaches, cache)
+		return func(set int, capacity int) ReplacementPolicy {
+			return &testPolicy{LRU: NewLRU(capacity), set: set, capacity: capacity}
+		}
+	}, validator(func(params PolicyParams, check func(string, error)) {
+		check("bias", params.CheckInt("bias", 0, 3))
+	}))
+
+	// A policy registered by a library that keeps its own lists of lines
+	RegisterSetAssociativePolicy("test_lists", perSet(func(set int, capacity int) ReplacementPolicy {
+		return NewLRU(capacity)
+	}), nil)
+}
+
+func TestCustomPolicy(t *testing.T) {
+	testPolicyCaches = nil
+	config := &CacheConfig{
+		Caches: []Cache{{
+			Name:         "L1",
+			Size:         256,
+			LineSize:     64,
+			Kind:         "2way",
+			PolicyName:   "test_policy",
+			PolicyParams: PolicyParams{"bias": 1.0},
+		}},
+	}
+	if errs := InitializeCaches(config); len(errs) > 0 {
+		t.Fatal(ConfigErrors(errs))
+	}
+
+	// The factory is called once for the cache, and its constructor once
+	// per set
+	c := &config.Caches[0]
+	if len(testPolicyCaches) != 1 || testPolicyCaches[0] != c {
+		t.Fatalf("got the factory called for %d caches, want once for L1", len(testPolicyCaches))
+	}
+	if bias := testPolicyCaches[0].PolicyParams.Int("bias", 0); bias != 1 {
+		t.Errorf("got bias %d, want 1", bias)
+	}
+	for s, set := range c.Sets {
+		policy, ok := set.Policy.(*testPolicy)
+		if !ok {
+			t.Fatalf("set %d: got policy %T, want the test policy", s, set.Policy)
+		}
+		if policy.set != s || policy.capacity != 2 {
+			t.Errorf("set %d: got a policy for set %d of %d lines, want set %d of 2 lines", s, policy.set, policy.capacity, s)
+		}
+	}
+}
+
+func TestUnknownPolicy(t *testing.T) {
+	names := PolicyNames()
+	if !sort.StringsAreSorted(names) || !contains(names, "test_policy") || !contains(names, "lru") {
+		t.Errorf("got policy names %v, want the sorted built-in and registered policies", names)
+	}
+
+	config := &CacheConfig{
+		Caches: []Cache{{Name: "L1", Size: 256, LineSize: 64, Kind: "2way", PolicyName: "mru"}},
+	}
+	want := []ConfigError{{
+		Cache:   "L1",
+		Path:    "caches[0].replacement_policy",
+		Message: `unknown policy "mru", expected one of ` + strings.Join(names, ", "),
+	}}
+	if errs := config.Validate(); !reflect.DeepEqual(errs, want) {
+		t.Errorf("got %v, want %v", errs, want)
+	}
+}
+
+func TestPolicyParamsErrors(t *testing.T) {
+	tests := []struct {
+		policy  string
+		params  PolicyParams
+		path    string
+		message string
+	}{
+		{
+			policy:  "test_policy",
+			params:  PolicyParams{"bias": 5.0},
+			path:    "caches[0].policy_params.bias",
+			message: "must be an integer between 0 and 3, got 5",
+		},
+		{
+			policy:  "test_policy",
+			params:  PolicyParams{"bais": 1.0},
+			path:    "caches[0].policy_params.bais",
+			message: "unknown parameter, expected one of bias",
+		},
+		{
+			policy:  "lru",
+			params:  PolicyParams{"bias": 1.0},
+			path:    "caches[0].policy_params.bias",
+			message: "unknown parameter, the policy takes no parameters",
+		},
+		{
+			policy:  "",
+			params:  PolicyParams{"bias": 1.0},
+			path:    "caches[0].policy_params",
+			message: "the default policy takes no parameters",
+		},
+		{
+			policy:  "lfu",
+			params:  PolicyParams{"aging": "sometimes"},
+			path:    "caches[0].policy_params.aging",
+			message: "must be one of none, halving, dynamic, got sometimes",
+		},
+		{
+			policy:  "lfu",
+			params:  PolicyParams{"agign": "dynamic"},
+			path:    "caches[0].policy_params.agign",
+			message: "unknown parameter, expected one of aging, aging_interval, counter_bits, tie_break",
+		},
+		{
+			policy:  "srrip",
+			params:  PolicyParams{"rrpv_bits": 2.5},
+			path:    "caches[0].policy_params.rrpv_bits",
+			message: "must be an integer between 1 and 8, got 2.5",
+		},
+		{
+			policy:  "brrip",
+			params:  PolicyParams{"epsilon": 2.0},
+			path:    "caches[0].policy_params.epsilon",
+			message: "must be a number between 0 and 1, got 2",
+		},
+	}
+
+	for _, test := range tests {
+		config := &CacheConfig{
+			Caches: []Cache{{
+				Name:         "L1",
+				Size:         256,
+				LineSize:     64,
+				Kind:         "2way",
+				PolicyName:   test.policy,
+				PolicyParams: test.params,
+			}},
+		}
+		want := []ConfigError{{Cache: "L1", Path: test.path, Message: test.message}}
+		if errs := config.Validate(); !reflect.DeepEqual(errs, want) {
+			t.Errorf("%s %v: got %v, want %v", test.policy, test.params, errs, want)
+		}
+	}
+}
+
+func TestSetAssociativePolicies(t *testing.T) {
+	for _, policy := range []string{"arc", "2q", "test_lists"} {
+		for _, kind := range []string{"direct", "2way"} {
+			config := &CacheConfig{
+				Caches: []Cache{{Name: "L1", Size: 256, LineSize: 64, Kind: kind, PolicyName: policy}},
+			}
+			want := []ConfigError{}
+			if kind == "direct" {
+				want = append(want, ConfigError{
+					Cache:   "L1",
+					Path:    "caches[0].replacement_policy",
+					Message: policy + " needs a set associative cache",
+				})
+			}
+			if errs := config.Validate(); !reflect.DeepEqual(errs, want) {
+				t.Errorf("%s %s cache: got %v, want %v", policy, kind, errs, want)
+			}
+		}
+	}
+}
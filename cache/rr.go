@@ -3,7 +3,10 @@ package cache
 // This file implement the Round Robin replacement policy
 // The Round Robin policy evicts the next cache line in the set
 // in a round robin fashion based on the round robin index. It
-// is used as the default replacement policy in the cache simulator
+// is used as the default replacement policy in the cache simulator.
+// The index only moves on evictions and ignores the order in which the
+// lines were filled, so it is not FIFO when the set is refilled after
+// invalidations; the FIFO policy is in fifo.go.
 
 type RR struct {
 	Capacity int
@@ -18,12 +21,12 @@ func NewRR(capacity int) *RR {
 }
 
 // No action required to insert a line
-func (c *RR) Insert(line *CacheLine) {
+func (c *RR) Insert(line *CacheLine, access Access) {
 }
 
 // Evict returns the index of the next line to evict
 // based on the round robin index
-func (c *RR) Evict() (index int) {
+func (c *RR) Evict(access Access) (index int) {
 	evictIndex := c.Index
 	// Wrap around the index if it exceeds the capacity
 	c.Index = (c.Index + 1) % c.Capacity
@@ -31,5 +34,9 @@ func (c *RR) Evict() (index int) {
 }
 
 // No action required to update a line
-func (c *RR) Update(line *CacheLine) {
+func (c *RR) Update(line *CacheLine, access Access) {
+}
+
+// No action required to remove a line
+func (c *RR) Remove(line *CacheLine) {
 }
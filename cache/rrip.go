@@ -0,0 +1,119 @@
+package cache
+
+// This file contains the implementation of the re-reference interval
+// prediction (RRIP) replacement policies. Every line holds a re-reference
+// prediction value (RRPV) of M bits, where 0 predicts a near re-reference
+// and 2^M - 1 a distant one. A hit predicts a near re-reference, and the
+// victim is a line predicted to be re-referenced in the distant future,
+// ageing every line of the set until one is found. The policies only
+// differ in the prediction made for newly inserted lines:
+//   - Static RRIP (SRRIP) inserts lines with a long re-reference interval
+//     (2^M - 2), so that lines that are never reused leave the cache
+//     before the lines that are.
+//   - Bimodal RRIP (BRRIP) inserts most lines with a distant re-reference
+//     interval and only a fraction epsilon with a long one, which protects
+//     the cache from thrashing when the working set doesn't fit.
+//   - Dynamic RRIP (DRRIP) uses set dueling to pick SRRIP or BRRIP for
+//     the whole cache depending on which one misses the least.
+
+import "math/rand"
+
+// The default parameters of the RRIP policies
+const (
+	defaultRRPVBits int     = 2
+	defaultEpsilon  float64 = 1.0 / 32
+)
+
+// The insertion modes of the RRIP policies
+const (
+	staticInsertion int = iota
+	bimodalInsertion
+	dynamicInsertion
+)
+
+type RRIP struct {
+	rrpv    []int
+	maxRRPV int
+	mode    int
+	epsilon float64
+	rng     *rand.Rand
+	set     int         // The index of the set, used for set dueling
+	dueling *SetDueling // The set dueling state shared by the sets of the cache
+}
+
+// newRRIP creates an RRIP policy for a set with the given insertion mode
+func newRRIP(capacity int, params PolicyParams, mode int) *RRIP {
+	maxRRPV := 1<<params.Int("rrpv_bits", defaultRRPVBits) - 1
+	rrpv := make([]int, capacity)
+	for i := range rrpv {
+		rrpv[i] = maxRRPV
+	}
+	return &RRIP{
+		rrpv:    rrpv,
+		maxRRPV: maxRRPV,
+		mode:    mode,
+		epsilon: params.Float("epsilon", defaultEpsilon),
+	}
+}
+
+func NewSRRIP(capacity int, params PolicyParams) *RRIP {
+	return newRRIP(capacity, params, staticInsertion)
+}
+
+// NewBRRIP creates a BRRIP policy drawing the bimodal insertions from
+// the given random number generator
+func NewBRRIP(capacity int, params PolicyParams, rng *rand.Rand) *RRIP {
+	rrip := newRRIP(capacity, params, bimodalInsertion)
+	rrip.rng = rng
+	return rrip
+}
+
+// NewDRRIP creates a DRRIP policy for the set with the given index,
+// using the set dueling state of its cache
+func NewDRRIP(capacity int, params PolicyParams, rng *rand.Rand, set int, dueling *SetDueling) *RRIP {
+	rrip := newRRIP(capacity, params, dynamicInsertion)
+	rrip.rng = rng
+	rrip.set = set
+	rrip.dueling = dueling
+	return rrip
+}
+
+// Insert predicts the re-reference interval of a new line
+func (rrip *RRIP) Insert(line *CacheLine, access Access) {
+	bimodal := rrip.mode == bimodalInsertion
+	if rrip.mode == dynamicInsertion {
+		rrip.dueling.Miss(rrip.set)
+		bimodal = rrip.dueling.UseB(rrip.set)
+	}
+
+	if bimodal && rrip.rng.Float64() >= rrip.epsilon {
+		rrip.rrpv[line.Index] = rrip.maxRRPV
+	} else {
+		rrip.rrpv[line.Index] = rrip.maxRRPV - 1
+	}
+}
+
+// Update predicts a near re-reference for a line that hit
+func (rrip *RRIP) Update(line *CacheLine, access Access) {
+	rrip.rrpv[line.Index] = 0
+}
+
+// Evict returns the index of the first line predicted to be re-referenced
+// in the distant future, ageing all lines until one is found
+func (rrip *RRIP) Evict(access Access) int {
+	for {
+		for i, rrpv := range rrip.rrpv {
+			if rrpv == rrip.maxRRPV {
+				return i
+			}
+		}
+		for i := range rrip.rrpv {
+			rrip.rrpv[i]++
+		}
+	}
+}
+
+// Remove predicts a distant re-reference for an invalidated line
+func (rrip *RRIP) Remove(line *CacheLine) {
+	rrip.rrpv[line.Index] = rrip.maxRRPV
+}
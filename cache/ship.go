@@ -0,0 +1,112 @@
+package cache
+
+// This file contains the implementation of the signature-based hit
+// predictor (SHiP) policy of Wu et al., using the PC of the instructions
+// as signatures. SHiP is SRRIP with a smarter insertion: a signature
+// history counter table (SHCT) learns whether the lines inserted by each
+// PC are reused. A hit increments the counter of the PC that inserted the
+// line, and the eviction of a line that was never reused decrements it.
+// Lines inserted by a PC whose counter is zero are predicted to be dead
+// and inserted with a distant re-reference interval, so they leave the
+// cache first. The other lines are inserted with a long one, as in SRRIP.
+
+// The default parameters of SHiP
+const defaultSHCTBits int = 14
+
+// The SHiPPredictor struct holds the SHCT shared by the sets of a cache,
+// and the accuracy of its predictions
+type SHiPPredictor struct {
+	shct     *counterTable
+	accuracy *pcAccuracy
+}
+
+func NewSHiPPredictor(params PolicyParams) *SHiPPredictor {
+	return &SHiPPredictor{
+		shct: newCounterTable(
+			params.Int("shct_bits", defaultSHCTBits),
+			params.Int("counter_bits", defaultPCCounterBits),
+			1,
+		),
+		accuracy: newPCAccuracy(params.Int("pc_stats", defaultPCStats)),
+	}
+}
+
+// Stats returns the accuracy of the reuse predictions, checked when the
+// lines are evicted
+func (predictor *SHiPPredictor) Stats() map[string]interface{} {
+	return predictor.accuracy.stats()
+}
+
+type SHiP struct {
+	rrpv      []int
+	maxRRPV   int
+	pcs       []uint64 // The PC that inserted the line held in each way
+	reused    []bool   // Whether the line held in each way was hit
+	predicted []bool   // Whether the line held in each way was predicted to be reused
+	predictor *SHiPPredictor
+}
+
+func NewSHiP(capacity int, params PolicyParams, predictor *SHiPPredictor) *SHiP {
+	maxRRPV := 1<<params.Int("rrpv_bits", defaultRRPVBits) - 1
+	rrpv := make([]int, capacity)
+	for i := range rrpv {
+		rrpv[i] = maxRRPV
+	}
+	return &SHiP{
+		rrpv:      rrpv,
+		maxRRPV:   maxRRPV,
+		pcs:       make([]uint64, capacity),
+		reused:    make([]bool, capacity),
+		predicted: make([]bool, capacity),
+		predictor: predictor,
+	}
+}
+
+// Insert predicts the re-reference interval of a new line from the
+// counter of the PC that inserts it
+func (ship *SHiP) Insert(line *CacheLine, access Access) {
+	way := line.Index
+	live := ship.predictor.shct.get(access.PC) > 0
+	ship.pcs[way] = access.PC
+	ship.reused[way] = false
+	ship.predicted[way] = live
+	if live {
+		ship.rrpv[way] = ship.maxRRPV - 1
+	} else {
+		ship.rrpv[way] = ship.maxRRPV
+	}
+}
+
+// Update predicts a near re-reference for a line that hit, and trains
+// the counter of the PC that inserted it
+func (ship *SHiP) Update(line *CacheLine, access Access) {
+	way := line.Index
+	ship.rrpv[way] = 0
+	ship.reused[way] = true
+	ship.predictor.shct.increment(ship.pcs[way])
+}
+
+// Evict returns the index of the first line predicted to be re-referenced
+// in the distant future, ageing all lines until one is found. The counter
+// of the PC that inserted the victim is decremented if it was never hit.
+func (ship *SHiP) Evict(access Access) int {
+	for {
+		for way, rrpv := range ship.rrpv {
+			if rrpv == ship.maxRRPV {
+				if !ship.reused[way] {
+					ship.predictor.shct.decrement(ship.pcs[way])
+				}
+				ship.predictor.accuracy.record(ship.pcs[way], ship.predicted[way] == ship.reused[way])
+				return way
+			}
+		}
+		for i := range ship.rrpv {
+			ship.rrpv[i]++
+		}
+	}
+}
+
+// Remove predicts a distant re-reference for an invalidated line
+func (ship *SHiP) Remove(line *CacheLine) {
+	ship.rrpv[line.Index] = ship.maxRRPV
+}
@@ -0,0 +1,111 @@
+package cache
+
+// This file contains the implementation of the 2Q replacement policy of
+// Johnson and Shasha. New lines enter A1in, a FIFO queue holding a
+// fraction kin of the set. Lines leaving A1in are evicted, and their
+// addresses are remembered in the ghost queue A1out, which holds the
+// addresses of a fraction kout of the set. A miss on an address found in
+// A1out shows that the line is reused, so it enters Am, an LRU list
+// holding the rest of the set. Lines accessed only once are therefore
+// evicted from A1in without disturbing the lines reused in Am.
+
+// The default parameters of the 2Q policy
+const (
+	defaultKin  float64 = 0.25
+	defaultKout float64 = 0.5
+)
+
+// The TwoQStats struct counts the misses on the ghost queues of a cache
+type TwoQStats struct {
+	ghostHits uint64
+}
+
+// Stats returns the ghost queue hits
+func (stats *TwoQStats) Stats() map[string]interface{} {
+	return map[string]interface{}{
+		"ghost_hits": stats.ghostHits,
+	}
+}
+
+type TwoQ struct {
+	kin, kout int
+	a1in      *orderedSet // The ways of the lines seen once, from newest to oldest
+	a1out     *orderedSet // The addresses evicted from A1in, from newest to oldest
+	am        *orderedSet // The ways of the reused lines, from MRU to LRU
+	addresses []uint64    // The address of the line held in each way
+	stats     *TwoQStats  // The counters shared by the sets of the cache
+}
+
+func NewTwoQ(capacity int, params PolicyParams, stats *TwoQStats) *TwoQ {
+	kin := int(params.Float("kin", defaultKin) * float64(capacity))
+	if kin < 1 {
+		kin = 1
+	}
+	kout := int(params.Float("kout", defaultKout) * float64(capacity))
+	if kout < 1 {
+		kout = 1
+	}
+
+	return &TwoQ{
+		kin:       kin,
+		kout:      kout,
+		a1in:      newOrderedSet(),
+		a1out:     newOrderedSet(),
+		am:        newOrderedSet(),
+		addresses: make([]uint64, capacity),
+		stats:     stats,
+	}
+}
+
+// Insert adds the line to Am if its address was in A1out, and to A1in
+// otherwise
+func (q *TwoQ) Insert(line *CacheLine, access Access) {
+	q.addresses[line.Index] = access.Address
+	if q.a1out.remove(access.Address) {
+		q.stats.ghostHits++
+		q.am.pushFront(uint64(line.Index))
+	} else {
+		q.a1in.pushFront(uint64(line.Index))
+	}
+}
+
+// Update moves a line of Am that hit to its MRU position. Hits on lines
+// of A1in don't change their position, as they are likely correlated
+// with the access that brought the line in.
+func (q *TwoQ) Update(line *CacheLine, access Access) {
+	way := uint64(line.Index)
+	if q.am.contains(way) {
+		q.am.pushFront(way)
+	}
+}
+
+// Evict returns the oldest line of A1in if it holds more than its share
+// of the set, remembering its address in A1out, and the LRU line of Am
+// otherwise
+func (q *TwoQ) Evict(access Access) int {
+	if q.a1in.len() > q.kin || q.am.len() == 0 {
+		if way, ok := q.a1in.popBack(); ok {
+			q.a1out.pushFront(q.addresses[way])
+			if q.a1out.len() > q.kout {
+				q.a1out.popBack()
+			}
+			return int(way)
+		}
+	}
+
+	// Both queues are only empty if the lines of the set were filled
+	// without the policy, in which case the first way is evicted
+	way, ok := q.am.popBack()
+	if !ok {
+		return 0
+	}
+	return int(way)
+}
+
+// Remove forgets an invalidated line
+func (q *TwoQ) Remove(line *CacheLine) {
+	way := uint64(line.Index)
+	if !q.a1in.remove(way) {
+		q.am.remove(way)
+	}
+}
@@ -0,0 +1,307 @@
+package cache
+
+// This file contains the validation of the cache configuration. The
+// configuration is checked before any cache is initialized, so that
+// mistakes in the config file are reported with the name of the cache
+// and the JSON path of the field, rather than causing a panic deep in
+// the simulator or silently producing wrong results.
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// The ConfigError struct describes a problem with a single field
+// of the cache configuration
+type ConfigError struct {
+	Cache   string // The name of the cache, empty for top level fields
+	Path    string // The JSON path of the field, e.g. caches[1].size
+	Message string // The description of the problem
+}
+
+// Error returns the description of the configuration error
+func (e ConfigError) Error() string {
+	if e.Cache == "" {
+		return fmt.Sprintf("%s: %s", e.Path, e.Message)
+	}
+	return fmt.Sprintf("%s (cache %q): %s", e.Path, e.Cache, e.Message)
+}
+
+// The ConfigErrors type holds every problem found in a configuration, so
+// that they can be returned as a single error
+type ConfigErrors []ConfigError
+
+// Error returns the description of every problem, one per line
+func (errs ConfigErrors) Error() string {
+	messages := make([]string, len(errs))
+	for i, e := range errs {
+		messages[i] = e.Error()
+	}
+	return strings.Join(messages, "\n")
+}
+
+// Validate checks the cache configuration and returns a list of every
+// problem found. An empty list means the configuration is valid.
+func (config *CacheConfig) Validate() []ConfigError {
+	errs := []ConfigError{}
+
+	if len(config.Caches) == 0 {
+		errs = append(errs, ConfigError{
+			Path:    "caches",
+			Message: "at least one cache must be given",
+		})
+	}
+
+	addressBits := config.AddressBits
+	if addressBits == 0 {
+		addressBits = DefaultAddressBits
+	} else if addressBits < 0 || addressBits > 64 {
+		errs = append(errs, ConfigError{
+			Path:    "address_bits",
+			Message: fmt.Sprintf("must be between 1 and 64, got %d", addressBits),
+		})
+		addressBits = DefaultAddressBits
+	}
+
+	switch config.Inclusion {
+	case "", NINE, Inclusive:
+	case Exclusive:
+		errs = append(errs, config.validateExclusive()...)
+	default:
+		errs = append(errs, ConfigError{
+			Path: "inclusion",
+			Message: fmt.Sprintf("unknown policy %q, expected %s, %s or %s",
+				config.Inclusion, Inclusive, Exclusive, NINE),
+		})
+	}
+
+	names := map[string]int{}
+	for i := range config.Caches {
+		cache := &config.Caches[i]
+		errs = append(errs, cache.validate(fmt.Sprintf("caches[%d]", i), addressBits)...)
+
+		if cache.Name == "" {
+			continue
+		}
+		if first, exists := names[cache.Name]; exists {
+			errs = append(errs, ConfigError{
+				Cache:   cache.Name,
+				Path:    fmt.Sprintf("caches[%d].name", i),
+				Message: fmt.Sprintf("duplicate name, already used by caches[%d]", first),
+			})
+		} else {
+			names[cache.Name] = i
+		}
+	}
+
+	if len(config.Caches) > 0 {
+		errs = append(errs, config.validateHierarchy()...)
+	}
+	errs = append(errs, config.validateCores()...)
+	errs = append(errs, config.validateCoherence()...)
+	errs = append(errs, config.validateDirectory()...)
+
+	return errs
+}
+
+// validateExclusive checks that the caches can be used in an exclusive
+// hierarchy. Lines move between levels as a whole, so every level must use
+// the same line size, and writes are only supported with write-back and
+// write-allocate caches, as a forwarded write would duplicate the line.
+func (config *CacheConfig) validateExclusive() []ConfigError {
+	errs := []ConfigError{}
+	for i, cache := range config.Caches {
+		path := fmt.Sprintf("caches[%d]", i)
+		if cache.LineSize != config.Caches[0].LineSize {
+			errs = append(errs, ConfigError{
+				Cache:   cache.Name,
+				Path:    path + ".line_size",
+				Message: "must match the line size of the other levels in an exclusive hierarchy",
+			})
+		}
+		if cache.WritePolicy == WriteThrough {
+			errs = append(errs, ConfigError{
+				Cache:   cache.Name,
+				Path:    path + ".write_policy",
+				Message: "must be " + WriteBack + " in an exclusive hierarchy",
+			})
+		}
+		if cache.WriteMissPolicy == NoWriteAllocate {
+			errs = append(errs, ConfigError{
+				Cache:   cache.Name,
+				Path:    path + ".write_miss_policy",
+				Message: "must be " + WriteAllocate + " in an exclusive hierarchy",
+			})
+		}
+	}
+	return errs
+}
+
+// validate checks the fields of a single cache. The path is the JSON
+// path of the cache in the configuration.
+func (cache *Cache) validate(path string, addressBits int) []ConfigError {
+	errs := []ConfigError{}
+	fail := func(field string, format string, args ...interface{}) {
+		errs = append(errs, ConfigError{
+			Cache:   cache.Name,
+			Path:    path + "." + field,
+			Message: fmt.Sprintf(format, args...),
+		})
+	}
+
+	if cache.Name == "" {
+		fail("name", "a name must be given")
+	}
+
+	// The geometry can only be checked if the line size is usable
+	validLineSize := isPowerOfTwo(cache.LineSize)
+	if !validLineSize {
+		fail("line_size", "must be a positive power of two, got %d", cache.LineSize)
+	}
+	if cache.Size <= 0 {
+		fail("size", "must be positive, got %d", cache.Size)
+	} else if validLineSize && cache.Size%cache.LineSize != 0 {
+		fail("size", "must be a multiple of line_size (%d), got %d", cache.LineSize, cache.Size)
+	}
+
+	cacheLines := 0
+	if validLineSize {
+		cacheLines = cache.Size / cache.LineSize
+	}
+
+	ways, err := ParseKind(cache.Kind, cacheLines)
+	if err != nil {
+		fail("kind", "%s", err)
+	}
+	switch {
+	case cache.Associativity < 0:
+		fail("associativity", "must be positive, got %d", cache.Associativity)
+	case err == nil && ways != 0 && cache.Associativity != 0 && ways != cache.Associativity:
+		fail("associativity", "%d does not match kind %q", cache.Associativity, cache.Kind)
+	case err == nil && ways == 0 && cache.Associativity == 0:
+		fail("kind", "either kind or associativity must be given")
+	}
+	if cache.Associativity > 0 {
+		ways = cache.Associativity
+	}
+
+	if cacheLines > 0 && ways > 0 {
+		if cacheLines%ways != 0 {
+			fail("size", "%d lines can't be divided into %d-way sets", cacheLines, ways)
+		} else if sets := cacheLines / ways; !isPowerOfTwo(sets) {
+			fail("size", "gives %d sets of %d ways, the number of sets must be a power of two", sets, ways)
+		} else if bits := log2(cache.LineSize) + log2(sets); bits > addressBits {
+			fail("size", "needs %d offset and index bits, more than the %d address bits", bits, addressBits)
+		}
+	}
+
+	validatePolicy(cache.PolicyName, cache.PolicyParams, ways == 1, "", fail)
+	if cache.WritePolicy != "" && cache.WritePolicy != WriteBack && cache.WritePolicy != WriteThrough {
+		fail("write_policy", "unknown policy %q, expected %s or %s",
+			cache.WritePolicy, WriteBack, WriteThrough)
+	}
+	if cache.WriteMissPolicy != "" && cache.WriteMissPolicy != WriteAllocate && cache.WriteMissPolicy != NoWriteAllocate {
+		fail("write_miss_policy", "unknown policy %q, expected %s or %s",
+			cache.WriteMissPolicy, WriteAllocate, NoWriteAllocate)
+	}
+
+	if cache.PrefetcherConfig != nil {
+		prefetcher := cache.PrefetcherConfig
+		if _, err := NewPrefetcher(*prefetcher, 1); err != nil {
+			fail("prefetcher.kind", "%s", err)
+		}
+		if prefetcher.Degree < 0 {
+			fail("prefetcher.degree", "must not be negative, got %d", prefetcher.Degree)
+		}
+		if prefetcher.TableSize < 0 {
+			fail("prefetcher.table_size", "must not be negative, got %d", prefetcher.TableSize)
+		}
+		if prefetcher.Latency < 0 {
+			fail("prefetcher.latency", "must not be negative, got %d", prefetcher.Latency)
+		}
+	}
+
+	if cache.VictimConfig != nil {
+		victim := cache.VictimConfig
+		if victim.Entries <= 0 {
+			fail("victim_cache.entries", "must be positive, got %d", victim.Entries)
+		}
+		validatePolicy(victim.PolicyName, victim.PolicyParams, false, "victim_cache.", fail)
+
+		// The future accesses of the lines are only recorded for the
+		// caches of the hierarchy, not for their victim caches
+		if victim.PolicyName == "opt" {
+			fail("victim_cache.replacement_policy", "opt can't be used by a victim cache")
+		}
+	}
+
+	return errs
+}
+
+// validatePolicy checks that the replacement policy with the given name is
+// registered and can be used by a cache that is direct-mapped or not, and
+// checks its parameters. The prefix is added to the path of the fields
+// reported to fail.
+func validatePolicy(name string, params PolicyParams, directMapped bool, prefix string, fail func(field string, format string, args ...interface{})) {
+	policy, registered := policies[name]
+	switch {
+	case name == "":
+		if len(params) > 0 {
+			fail(prefix+"policy_params", "the default policy takes no parameters")
+		}
+		return
+	case !registered:
+		fail(prefix+"replacement_policy", "unknown policy %q, expected one of %s",
+			name, strings.Join(PolicyNames(), ", "))
+		return
+	}
+
+	if directMapped && policy.setAssociative {
+		fail(prefix+"replacement_policy", "%s needs a set associative cache", name)
+	}
+
+	// A policy without a validator takes no parameters
+	var paramErrs map[string]error
+	if policy.validate != nil {
+		paramErrs = policy.validate(params)
+	} else {
+		paramErrs = map[string]error{}
+		for param := range params {
+			paramErrs[param] = fmt.Errorf("unknown parameter, the policy takes no parameters")
+		}
+	}
+	paramNames := []string{}
+	for name := range paramErrs {
+		paramNames = append(paramNames, name)
+	}
+	sort.Strings(paramNames)
+	for _, name := range paramNames {
+		fail(prefix+"policy_params."+name, "%s", paramErrs[name])
+	}
+}
+
+// isPowerOfTwo returns true if n is a positive power of two
+func isPowerOfTwo(n int) bool {
+	return n > 0 && n&(n-1) == 0
+}
+
+// log2 returns the base 2 logarithm of a power of two
+func log2(n int) int {
+	bits := 0
+	for n > 1 {
+		n >>= 1
+		bits++
+	}
+	return bits
+}
+
+// contains returns true if the list holds the given string
+func contains(list []string, s string) bool {
+	for _, item := range list {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
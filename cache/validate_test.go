@@ -0,0 +1,289 @@
+package cache
+
+// This file contains the tests of the validation of the cache configuration
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// validCache returns a valid 2-way cache of 4 lines with the given name
+func validCache(name string) Cache {
+	return Cache{Name: name, Size: 256, LineSize: 64, Kind: "2way"}
+}
+
+// validConfig returns a valid configuration with an L1 and an L2
+func validConfig() CacheConfig {
+	l1, l2 := validCache("L1"), validCache("L2")
+	l2.Size = 1024
+	return CacheConfig{Caches: []Cache{l1, l2}}
+}
+
+// TestValidate checks that every rule of the validation reports the path
+// and the message of the field breaking it, and nothing else
+func TestValidate(t *testing.T) {
+	tests := []struct {
+		name   string
+		change func(config *CacheConfig)
+		errs   []ConfigError
+	}{
+		{"valid", func(config *CacheConfig) {}, []ConfigError{}},
+		{"no caches", func(config *CacheConfig) { config.Caches = nil }, []ConfigError{
+			{Path: "caches", Message: "at least one cache must be given"},
+		}},
+		{"address bits", func(config *CacheConfig) { config.AddressBits = 65 }, []ConfigError{
+			{Path: "address_bits", Message: "must be between 1 and 64, got 65"},
+		}},
+		{"unknown inclusion", func(config *CacheConfig) { config.Inclusion = "mostly" }, []ConfigError{
+			{Path: "inclusion", Message: `unknown policy "mostly", expected inclusive, exclusive or nine`},
+		}},
+		{"exclusive line size", func(config *CacheConfig) {
+			config.Inclusion = Exclusive
+			config.Caches[1].LineSize = 128
+		}, []ConfigError{
+			{Cache: "L2", Path: "caches[1].line_size", Message: "must match the line size of the other levels in an exclusive hierarchy"},
+		}},
+		{"exclusive write-through", func(config *CacheConfig) {
+			config.Inclusion = Exclusive
+			config.Caches[0].WritePolicy = WriteThrough
+		}, []ConfigError{
+			{Cache: "L1", Path: "caches[0].write_policy", Message: "must be write-back in an exclusive hierarchy"},
+		}},
+		{"exclusive no-write-allocate", func(config *CacheConfig) {
+			config.Inclusion = Exclusive
+			config.Caches[1].WriteMissPolicy = NoWriteAllocate
+		}, []ConfigError{
+			{Cache: "L2", Path: "caches[1].write_miss_policy", Message: "must be write-allocate in an exclusive hierarchy"},
+		}},
+		{"duplicate name", func(config *CacheConfig) { config.Caches[1].Name = "L1" }, []ConfigError{
+			{Cache: "L1", Path: "caches[1].name", Message: "duplicate name, already used by caches[0]"},
+		}},
+		{"no name", func(config *CacheConfig) { config.Caches[1].Name = "" }, []ConfigError{
+			{Path: "caches[1].name", Message: "a name must be given"},
+		}},
+		{"line size", func(config *CacheConfig) { config.Caches[0].LineSize = 48 }, []ConfigError{
+			{Cache: "L1", Path: "caches[0].line_size", Message: "must be a positive power of two, got 48"},
+		}},
+		{"no size", func(config *CacheConfig) { config.Caches[0].Size = 0 }, []ConfigError{
+			{Cache: "L1", Path: "caches[0].size", Message: "must be positive, got 0"},
+		}},
+		{"size not a multiple of the line size", func(config *CacheConfig) { config.Caches[0].Size = 260 }, []ConfigError{
+			{Cache: "L1", Path: "caches[0].size", Message: "must be a multiple of line_size (64), got 260"},
+		}},
+		{"unknown kind", func(config *CacheConfig) { config.Caches[0].Kind = "twoway" }, []ConfigError{
+			{Cache: "L1", Path: "caches[0].kind", Message: `unknown cache kind "twoway", expected "direct", "full" or "Nway"`},
+		}},
+		{"no kind", func(config *CacheConfig) { config.Caches[0].Kind = "" }, []ConfigError{
+			{Cache: "L1", Path: "caches[0].kind", Message: "either kind or associativity must be given"},
+		}},
+		{"associativity", func(config *CacheConfig) {
+			config.Caches[0].Kind = ""
+			config.Caches[0].Associativity = -2
+		}, []ConfigError{
+			{Cache: "L1", Path: "caches[0].associativity", Message: "must be positive, got -2"},
+		}},
+		{"associativity mismatch", func(config *CacheConfig) { config.Caches[0].Associativity = 4 }, []ConfigError{
+			{Cache: "L1", Path: "caches[0].associativity", Message: `4 does not match kind "2way"`},
+		}},
+		{"ways not dividing the lines", func(config *CacheConfig) { config.Caches[0].Kind = "3way" }, []ConfigError{
+			{Cache: "L1", Path: "caches[0].size", Message: "4 lines can't be divided into 3-way sets"},
+		}},
+		{"sets not a power of two", func(config *CacheConfig) {
+			config.Caches[0].Size = 384
+		}, []ConfigError{
+			{Cache: "L1", Path: "caches[0].size", Message: "gives 3 sets of 2 ways, the number of sets must be a power of two"},
+		}},
+		{"address bits too few", func(config *CacheConfig) { config.AddressBits = 8 }, []ConfigError{
+			{Cache: "L2", Path: "caches[1].size", Message: "needs 9 offset and index bits, more than the 8 address bits"},
+		}},
+		{"unknown replacement policy", func(config *CacheConfig) { config.Caches[0].PolicyName = "mru" }, []ConfigError{
+			{Cache: "L1", Path: "caches[0].replacement_policy", Message: `unknown policy "mru", expected one of ` + strings.Join(PolicyNames(), ", ")},
+		}},
+		{"unknown write policy", func(config *CacheConfig) { config.Caches[0].WritePolicy = "write-around" }, []ConfigError{
+			{Cache: "L1", Path: "caches[0].write_policy", Message: `unknown policy "write-around", expected write-back or write-through`},
+		}},
+		{"unknown write miss policy", func(config *CacheConfig) { config.Caches[0].WriteMissPolicy = "allocate" }, []ConfigError{
+			{Cache: "L1", Path: "caches[0].write_miss_policy", Message: `unknown policy "allocate", expected write-allocate or no-write-allocate`},
+		}},
+		{"prefetcher", func(config *CacheConfig) {
+			config.Caches[0].PrefetcherConfig = &PrefetcherConfig{Kind: "markov", Degree: -1, TableSize: -2, Latency: -3}
+		}, []ConfigError{
+			{Cache: "L1", Path: "caches[0].prefetcher.kind", Message: `unknown prefetcher "markov", expected next_line or stride`},
+			{Cache: "L1", Path: "caches[0].prefetcher.degree", Message: "must not be negative, got -1"},
+			{Cache: "L1", Path: "caches[0].prefetcher.table_size", Message: "must not be negative, got -2"},
+			{Cache: "L1", Path: "caches[0].prefetcher.latency", Message: "must not be negative, got -3"},
+		}},
+		{"victim cache entries", func(config *CacheConfig) {
+			config.Caches[0].VictimConfig = &VictimCacheConfig{}
+		}, []ConfigError{
+			{Cache: "L1", Path: "caches[0].victim_cache.entries", Message: "must be positive, got 0"},
+		}},
+		{"victim cache opt", func(config *CacheConfig) {
+			config.Caches[0].VictimConfig = &VictimCacheConfig{Entries: 2, PolicyName: "opt"}
+		}, []ConfigError{
+			{Cache: "L1", Path: "caches[0].victim_cache.replacement_policy", Message: "opt can't be used by a victim cache"},
+		}},
+		{"unknown next level", func(config *CacheConfig) { config.Caches[0].NextLevel = "L3" }, []ConfigError{
+			{Cache: "L1", Path: "caches[0].next_level", Message: `unknown cache "L3", expected one of L1, L2 or memory`},
+		}},
+		{"own next level", func(config *CacheConfig) { config.Caches[1].NextLevel = "L2" }, []ConfigError{
+			{Cache: "L2", Path: "caches[1].next_level", Message: "a cache can't be its own next level"},
+		}},
+		{"next level cycle", func(config *CacheConfig) { config.Caches[1].NextLevel = "L1" }, []ConfigError{
+			{Cache: "L1", Path: "caches[0].next_level", Message: "the next levels form a cycle instead of reaching memory"},
+		}},
+		{"unknown accesses", func(config *CacheConfig) { config.Caches[0].Serves = "branches" }, []ConfigError{
+			{Cache: "L1", Path: "caches[0].serves", Message: `unknown accesses "branches", expected instruction, data or unified`},
+			{Path: "caches", Message: "no first-level cache serves instruction accesses"},
+			{Path: "caches", Message: "no first-level cache serves data accesses"},
+		}},
+		{"lower level serving accesses", func(config *CacheConfig) { config.Caches[1].Serves = ServesData }, []ConfigError{
+			{Cache: "L2", Path: "caches[1].serves", Message: "only first-level caches serve accesses, this cache is the next level of another one"},
+		}},
+		{"accesses served twice", func(config *CacheConfig) {
+			l1d := validCache("L1D")
+			l1d.NextLevel = "L2"
+			config.Caches = append([]Cache{l1d}, config.Caches...)
+		}, []ConfigError{
+			{Cache: "L1", Path: "caches[1].serves", Message: "instruction accesses are already served by caches[0]"},
+			{Cache: "L1", Path: "caches[1].serves", Message: "data accesses are already served by caches[0]"},
+		}},
+		{"accesses not served", func(config *CacheConfig) { config.Caches[0].Serves = ServesInstructions }, []ConfigError{
+			{Path: "caches", Message: "no first-level cache serves data accesses"},
+		}},
+		{"negative cores", func(config *CacheConfig) { config.Cores = -1 }, []ConfigError{
+			{Path: "cores", Message: "must not be negative, got -1"},
+		}},
+		{"unknown interleaving", func(config *CacheConfig) { config.Interleave = "random" }, []ConfigError{
+			{Path: "interleave", Message: `unknown interleaving "random", expected round-robin or timestamp`},
+		}},
+		{"shared cache above a private cache", func(config *CacheConfig) { config.Caches[1].Private = true }, []ConfigError{
+			{Cache: "L1", Path: "caches[0].private", Message: `a shared cache can't pass its misses to the private cache "L2"`},
+		}},
+		{"unknown protocol", func(config *CacheConfig) { config.Coherence = "msi" }, []ConfigError{
+			{Path: "coherence", Message: `unknown protocol "msi", expected one of mesi, moesi`},
+		}},
+		{"coherent exclusive hierarchy", func(config *CacheConfig) {
+			config.Coherence = "mesi"
+			config.Inclusion = Exclusive
+		}, []ConfigError{
+			{Path: "inclusion", Message: "an exclusive hierarchy can't be kept coherent"},
+		}},
+		{"coherent line size", func(config *CacheConfig) {
+			config.Coherence = "mesi"
+			config.Caches[1].LineSize = 128
+		}, []ConfigError{
+			{Cache: "L2", Path: "caches[1].line_size", Message: "must match the line size of the other levels in a coherent hierarchy"},
+		}},
+		{"coherent private prefetcher and victim cache", func(config *CacheConfig) {
+			config.Coherence = "mesi"
+			config.Caches[0].Private = true
+			config.Caches[0].PrefetcherConfig = &PrefetcherConfig{Kind: NextLinePrefetcher}
+			config.Caches[0].VictimConfig = &VictimCacheConfig{Entries: 2}
+		}, []ConfigError{
+			{Cache: "L1", Path: "caches[0].prefetcher", Message: "private caches can't prefetch in a coherent hierarchy"},
+			{Cache: "L1", Path: "caches[0].victim_cache", Message: "private caches can't have a victim cache in a coherent hierarchy"},
+		}},
+		{"directory without protocol", func(config *CacheConfig) {
+			config.DirectoryConfig = &DirectoryConfig{Entries: 8}
+		}, []ConfigError{
+			{Path: "directory", Message: "a directory needs a coherence protocol"},
+		}},
+		{"directory entries", func(config *CacheConfig) {
+			config.Coherence = "mesi"
+			config.DirectoryConfig = &DirectoryConfig{}
+		}, []ConfigError{
+			{Path: "directory.entries", Message: "must be positive, got 0"},
+		}},
+		{"directory associativity", func(config *CacheConfig) {
+			config.Coherence = "mesi"
+			config.DirectoryConfig = &DirectoryConfig{Entries: 8, Associativity: -1}
+		}, []ConfigError{
+			{Path: "directory.associativity", Message: "must be positive, got -1"},
+		}},
+		{"directory ways not dividing the entries", func(config *CacheConfig) {
+			config.Coherence = "mesi"
+			config.DirectoryConfig = &DirectoryConfig{Entries: 8, Associativity: 3}
+		}, []ConfigError{
+			{Path: "directory.entries", Message: "8 entries can't be divided into 3-way sets"},
+		}},
+		{"directory sets not a power of two", func(config *CacheConfig) {
+			config.Coherence = "mesi"
+			config.DirectoryConfig = &DirectoryConfig{Entries: 12, Associativity: 4}
+		}, []ConfigError{
+			{Path: "directory.entries", Message: "gives 3 sets of 4 ways, the number of sets must be a power of two"},
+		}},
+		{"directory sharers", func(config *CacheConfig) {
+			config.Coherence = "mesi"
+			config.DirectoryConfig = &DirectoryConfig{Entries: 8, Sharers: "coarse", Pointers: -1}
+		}, []ConfigError{
+			{Path: "directory.sharers", Message: `unknown format "coarse", expected bit-vector or limited-pointer`},
+			{Path: "directory.pointers", Message: "must not be negative, got -1"},
+		}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			config := validConfig()
+			test.change(&config)
+			if errs := config.Validate(); !reflect.DeepEqual(errs, test.errs) {
+				t.Errorf("got errors\n%v\nwant\n%v", ConfigErrors(errs), ConfigErrors(test.errs))
+			}
+		})
+	}
+}
+
+// TestParseKind checks the associativity given by each kind of a cache of
+// 4 lines, and the errors reported when the kind is validated with the
+// size and associativity of the cache
+func TestParseKind(t *testing.T) {
+	kindError := func(kind string) []ConfigError {
+		return []ConfigError{{Cache: "L1", Path: "caches[0].kind",
+			Message: `unknown cache kind "` + kind + `", expected "direct", "full" or "Nway"`}}
+	}
+	tests := []struct {
+		kind          string
+		associativity int
+		ways          int
+		errs          []ConfigError
+	}{
+		{kind: "direct", ways: 1, errs: []ConfigError{}},
+		{kind: "full", ways: 4, errs: []ConfigError{}},
+		{kind: "2way", ways: 2, errs: []ConfigError{}},
+		{kind: "", associativity: 2, errs: []ConfigError{}},
+		{kind: "0way", errs: kindError("0way")},
+		{kind: "-2way", errs: kindError("-2way")},
+		{kind: "twoway", errs: kindError("twoway")},
+		{kind: "2", errs: kindError("2")},
+		{kind: "way", errs: kindError("way")},
+		{kind: "3way", ways: 3, errs: []ConfigError{
+			{Cache: "L1", Path: "caches[0].size", Message: "4 lines can't be divided into 3-way sets"},
+		}},
+		{kind: "8way", ways: 8, errs: []ConfigError{
+			{Cache: "L1", Path: "caches[0].size", Message: "4 lines can't be divided into 8-way sets"},
+		}},
+		{kind: "2way", associativity: 4, ways: 2, errs: []ConfigError{
+			{Cache: "L1", Path: "caches[0].associativity", Message: `4 does not match kind "2way"`},
+		}},
+		{kind: "", errs: []ConfigError{
+			{Cache: "L1", Path: "caches[0].kind", Message: "either kind or associativity must be given"},
+		}},
+	}
+
+	for _, test := range tests {
+		// Only the empty kind gives no ways without being an error
+		ways, err := ParseKind(test.kind, 4)
+		if ways != test.ways || (err != nil) != (test.ways == 0 && test.kind != "") {
+			t.Errorf("ParseKind(%q, 4) = %d, %v, want %d ways", test.kind, ways, err, test.ways)
+		}
+
+		c := validCache("L1")
+		c.Kind, c.Associativity = test.kind, test.associativity
+		config := CacheConfig{Caches: []Cache{c}}
+		if errs := config.Validate(); !reflect.DeepEqual(errs, test.errs) {
+			t.Errorf("kind %q, associativity %d: got errors\n%v\nwant\n%v",
+				test.kind, test.associativity, ConfigErrors(errs), ConfigErrors(test.errs))
+		}
+	}
+}
@@ -0,0 +1,86 @@
+package cache
+
+// This file contains the victim cache that can be attached to any cache.
+// A victim cache is a small fully associative buffer holding the lines
+// recently evicted from its cache. A miss in the cache checks the victim
+// cache before going to the next level, and a line found there is swapped
+// with the line the cache evicts to make room for it. It mostly helps
+// direct-mapped caches, whose conflict misses are often on lines evicted
+// shortly before. The lines evicted from the victim cache are handled as
+// if they had been evicted from the cache itself.
+
+// The VictimCacheConfig struct represents the configuration of the
+// victim cache of a cache
+type VictimCacheConfig struct {
+	Entries      int          `json:"entries"`            // The number of lines held
+	PolicyName   string       `json:"replacement_policy"` // The replacement policy, LRU by default
+	PolicyParams PolicyParams `json:"policy_params"`      // The parameters of the policy
+}
+
+// The default replacement policy of victim caches
+const defaultVictimPolicy string = "lru"
+
+// NewVictimCache creates the victim cache described by the given
+// configuration, for a cache with the given line size and seed
+func NewVictimCache(config VictimCacheConfig, name string, lineSize int, seed int64, addressBits int) *Cache {
+	policy := config.PolicyName
+	if policy == "" {
+		policy = defaultVictimPolicy
+	}
+
+	victim := &Cache{
+		Name:         name + " victim cache",
+		Size:         config.Entries * lineSize,
+		LineSize:     lineSize,
+		Kind:         "full",
+		PolicyName:   policy,
+		PolicyParams: config.PolicyParams,
+		Seed:         seed,
+	}
+	victim.SetAssociativity()
+	victim.SetSetsSize()
+	victim.SetLinesSize()
+	victim.SetBitsSize(addressBits)
+	victim.SetDefaultPolicy()
+	return victim
+}
+
+// TakeVictim removes the line at the given address from the victim cache
+// of the cache. It returns the line and a boolean indicating if the victim
+// cache held it.
+func (cache *Cache) TakeVictim(lineAddress uint64) (CacheLine, bool) {
+	index, tag, _ := cache.Victim.GetMemoryInfo(lineAddress)
+	return cache.Victim.Invalidate(tag, index)
+}
+
+// PutVictim inserts a line evicted from the cache into its victim cache.
+// It returns the line the victim cache evicted to make room for it, with
+// its address, and a boolean indicating if a line was evicted.
+func (cache *Cache) PutVictim(lineAddress uint64, dirty bool, access Access) (CacheLine, uint64, bool) {
+	victim := cache.Victim
+	index, tag, _ := victim.GetMemoryInfo(lineAddress)
+	line := &CacheLine{
+		Tag:   tag,
+		Valid: true,
+		Dirty: dirty,
+		Index: -1,
+		Freq:  1,
+	}
+
+	evicted, wasEvicted := victim.Sets[index].Insert(line, access)
+	if !wasEvicted {
+		return CacheLine{}, 0, false
+	}
+	return evicted, victim.GetAddress(evicted.Tag, index), true
+}
+
+// MarkVictimDirty marks the line at the given address as dirty if the
+// victim cache of the cache holds it. It returns true if it does.
+func (cache *Cache) MarkVictimDirty(lineAddress uint64) bool {
+	index, tag, _ := cache.Victim.GetMemoryInfo(lineAddress)
+	hit, line := cache.Victim.CheckHitOrMiss(tag, index)
+	if hit {
+		line.Dirty = true
+	}
+	return hit
+}
@@ -0,0 +1,74 @@
+package instruction
+
+// This file contains the tests of the classification of the misses into
+// compulsory, capacity and conflict misses
+
+import (
+	"testing"
+
+	"github.com/nsengupta5/Cache-Simulator/cache"
+)
+
+// The expected classification of the misses of a cache
+type missCounts struct {
+	compulsory, capacity, conflict int
+}
+
+func TestClassifyMisses(t *testing.T) {
+	// A and C map to the first set of the direct-mapped cache, B and D
+	// to the second. The fully associative LRU shadow of 2 lines holds
+	// A and C when A misses again, holds D and A when B misses again, and
+	// A and B when C misses again.
+	trace := readLines("0", "80", "0", "40", "c0", "0", "40", "80")
+
+	tests := []struct {
+		kind   string
+		hits   int
+		counts missCounts
+	}{
+		{
+			// A misses again after C replaced it in its set, while the
+			// shadow still holds it, which is a conflict miss. A then
+			// hits, although D evicted it from the shadow, and B and C
+			// miss in both caches.
+			kind:   "direct",
+			hits:   1,
+			counts: missCounts{compulsory: 4, capacity: 2, conflict: 1},
+		},
+		{
+			// A fully associative LRU cache behaves as its own shadow,
+			// so none of its misses are conflict misses
+			kind:   "full",
+			hits:   1,
+			counts: missCounts{compulsory: 4, capacity: 3},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.kind, func(t *testing.T) {
+			config := &cache.CacheConfig{
+				ClassifyMisses: true,
+				Caches: []cache.Cache{{
+					Name:       "L1",
+					Size:       128,
+					LineSize:   64,
+					Kind:       test.kind,
+					PolicyName: "lru",
+				}},
+			}
+			runTrace(t, config, trace...)
+
+			c := &config.Caches[0]
+			if c.Hits != test.hits {
+				t.Errorf("got %d hits, want %d", c.Hits, test.hits)
+			}
+			got := missCounts{c.Classifier.Compulsory, c.Classifier.Capacity, c.Classifier.Conflict}
+			if got != test.counts {
+				t.Errorf("got %+v, want %+v", got, test.counts)
+			}
+			if total := got.compulsory + got.capacity + got.conflict; total != c.Misses {
+				t.Errorf("classified %d misses out of %d", total, c.Misses)
+			}
+		})
+	}
+}
@@ -0,0 +1,117 @@
+package instruction
+
+// This file contains the tests of the coherence protocols, run on two
+// cores with hand-checked traces
+
+import (
+	"testing"
+
+	"github.com/nsengupta5/Cache-Simulator/cache"
+)
+
+// The expected coherence activity of a core
+type coherenceCounts struct {
+	transactions, upgrades, invalidations, interventions, writebacks, coherenceMisses int
+}
+
+func TestCoherence(t *testing.T) {
+	// Both cores access line A, in the order of the trace
+	readA0, writeA0 := "0 "+lineA+" R 1 0", "0 "+lineA+" W 1 0"
+	readA1 := "0 " + lineA + " R 1 1"
+
+	tests := []struct {
+		name     string
+		protocol string
+		trace    []string
+		counts   []coherenceCounts
+		states   []cache.CoherenceState // The final states of A in each core
+	}{
+		{
+			// A line read by a single core is exclusive, and is then
+			// written without a transaction
+			name:     "exclusive write",
+			protocol: "mesi",
+			trace:    []string{readA0, writeA0},
+			counts:   []coherenceCounts{{transactions: 1}, {}},
+			states:   []cache.CoherenceState{cache.StateModified, cache.StateInvalid},
+		},
+		{
+			// The bus read of core 1 makes core 0 supply its modified
+			// copy and write it back
+			name:     "modified read",
+			protocol: "mesi",
+			trace:    []string{writeA0, readA1},
+			counts:   []coherenceCounts{{transactions: 1, interventions: 1, writebacks: 1}, {transactions: 1}},
+			states:   []cache.CoherenceState{cache.StateShared, cache.StateShared},
+		},
+		{
+			// Core 0 supplies its modified copy and keeps it owned, without
+			// writing it back
+			name:     "modified read",
+			protocol: "moesi",
+			trace:    []string{writeA0, readA1},
+			counts:   []coherenceCounts{{transactions: 1, interventions: 1}, {transactions: 1}},
+			states:   []cache.CoherenceState{cache.StateOwned, cache.StateShared},
+		},
+		{
+			// The exclusive copy of core 0 becomes shared without being
+			// supplied, and writing it again broadcasts an upgrade which
+			// invalidates the copy of core 1
+			name:     "upgrade",
+			protocol: "mesi",
+			trace:    []string{readA0, readA1, writeA0},
+			counts:   []coherenceCounts{{transactions: 2, upgrades: 1}, {transactions: 1, invalidations: 1}},
+			states:   []cache.CoherenceState{cache.StateModified, cache.StateInvalid},
+		},
+		{
+			// Reading A again after the upgrade is a coherence miss for
+			// core 1
+			name:     "coherence miss",
+			protocol: "mesi",
+			trace:    []string{readA0, readA1, writeA0, readA1},
+			counts: []coherenceCounts{
+				{transactions: 2, upgrades: 1, interventions: 1, writebacks: 1},
+				{transactions: 2, invalidations: 1, coherenceMisses: 1},
+			},
+			states: []cache.CoherenceState{cache.StateShared, cache.StateShared},
+		},
+		{
+			// The owned copy of core 0 is upgraded for the next write,
+			// invalidating core 1, which then misses on it again
+			name:     "coherence miss",
+			protocol: "moesi",
+			trace:    []string{writeA0, readA1, writeA0, readA1},
+			counts: []coherenceCounts{
+				{transactions: 2, upgrades: 1, interventions: 2},
+				{transactions: 2, invalidations: 1, coherenceMisses: 1},
+			},
+			states: []cache.CoherenceState{cache.StateOwned, cache.StateShared},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.protocol+" "+test.name, func(t *testing.T) {
+			config := newMultiCoreConfig()
+			config.Coherence = test.protocol
+			runTrace(t, config, test.trace...)
+
+			for core, want := range test.counts {
+				stats := config.CoherenceStats[core]
+				got := coherenceCounts{
+					transactions:    stats.Transactions,
+					upgrades:        stats.Upgrades,
+					invalidations:   stats.Invalidations,
+					interventions:   stats.Interventions,
+					writebacks:      stats.Writebacks,
+					coherenceMisses: stats.CoherenceMisses,
+				}
+				if got != want {
+					t.Errorf("core %d: got %+v, want %+v", core, got, want)
+				}
+				if state := config.CoherenceState(core, 0); state != test.states[core] {
+					t.Errorf("core %d: A is %s, want %s", core, state, test.states[core])
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,187 @@
+package instruction
+
+// This file contains the comparisons between several runs of the same
+// trace. The policy comparison runs the trace once for each policy, with
+// every cache of the hierarchy using that policy, and compares the hit
+// rate of each cache with the hit rate it has under a baseline policy.
+// The seed comparison runs the trace with several seeds for the random
+// number generators of the policies, and summarizes the hit rate of each
+// cache over the seeds. The runs are independent, so they are executed
+// concurrently, each in its own goroutine.
+
+import (
+	"math"
+	"runtime"
+	"sync"
+
+	"github.com/nsengupta5/Cache-Simulator/cache"
+)
+
+// The policies compared by the PLRU comparison mode, and the
+// baseline they are compared with
+var (
+	PLRUPolicies = []string{"lru", "plru_tree", "plru_bit"}
+	PLRUBaseline = "lru"
+)
+
+// ComparePolicies runs the trace with each of the given policies and
+// returns the statistics of every cache under each policy, along with the
+// difference between its hit rate and its hit rate under the baseline.
+// The configuration must not have been initialized yet. It returns an error
+// if any of the runs fails.
+func ComparePolicies(config cache.CacheConfig, traceFiles []string, policies []string, baseline string) (map[string]interface{}, error) {
+	configs := make([]cache.CacheConfig, len(policies))
+	for i, policy := range policies {
+		configs[i] = copyConfig(config)
+		// The parameters of the configured policies don't apply to the
+		// compared ones
+		for j := range configs[i].Caches {
+			configs[i].Caches[j].PolicyName = policy
+			configs[i].Caches[j].PolicyParams = nil
+		}
+	}
+	if err := runConfigs(configs, traceFiles); err != nil {
+		return nil, err
+	}
+
+	// Find the run of the baseline policy, if it was compared
+	var baselineConfig *cache.CacheConfig
+	for i, policy := range policies {
+		if policy == baseline {
+			baselineConfig = &configs[i]
+		}
+	}
+
+	results := map[string]interface{}{}
+	for i, policy := range policies {
+		cacheStats := []map[string]interface{}{}
+		for j := range configs[i].Caches {
+			c := &configs[i].Caches[j]
+			stats := map[string]interface{}{
+				"name":     c.Name,
+				"hits":     c.Hits,
+				"misses":   c.Misses,
+				"hit_rate": c.HitRate(),
+			}
+			if baselineConfig != nil {
+				stats["hit_rate_difference"] = c.HitRate() - baselineConfig.Caches[j].HitRate()
+			}
+			cacheStats = append(cacheStats, stats)
+		}
+		results[policy] = map[string]interface{}{
+			"caches":               cacheStats,
+			"main_memory_accesses": configs[i].MemoryAccesses,
+		}
+	}
+
+	return map[string]interface{}{
+		"baseline": baseline,
+		"policies": results,
+	}, nil
+}
+
+// CompareSeeds runs the trace n times, adding 0 to n-1 to the seed of every
+// cache, and returns the mean, minimum, maximum and sample standard
+// deviation of the hit rate of each cache over the runs.
+// The configuration must not have been initialized yet. It returns an error
+// if any of the runs fails.
+func CompareSeeds(config cache.CacheConfig, traceFiles []string, n int) (map[string]interface{}, error) {
+	configs := make([]cache.CacheConfig, n)
+	for i := range configs {
+		configs[i] = copyConfig(config)
+		for j := range configs[i].Caches {
+			configs[i].Caches[j].SetSeed()
+			configs[i].Caches[j].Seed += int64(i)
+		}
+	}
+	if err := runConfigs(configs, traceFiles); err != nil {
+		return nil, err
+	}
+
+	// The caches are taken from an initialized configuration, in which
+	// every core has its own copy of the private caches
+	cacheStats := []map[string]interface{}{}
+	for j, c := range configs[0].Caches {
+		hitRates := make([]float64, n)
+		seeds := make([]int64, n)
+		for i := range configs {
+			hitRates[i] = configs[i].Caches[j].HitRate()
+			seeds[i] = configs[i].Caches[j].Seed
+		}
+		cacheStats = append(cacheStats, map[string]interface{}{
+			"name":     c.Name,
+			"seeds":    seeds,
+			"hit_rate": summarize(hitRates),
+		})
+	}
+
+	return map[string]interface{}{
+		"runs":   n,
+		"caches": cacheStats,
+	}, nil
+}
+
+// summarize returns the mean, minimum, maximum and sample standard
+// deviation of the given values
+func summarize(values []float64) map[string]float64 {
+	mean, min, max := 0.0, math.Inf(1), math.Inf(-1)
+	for _, value := range values {
+		mean += value
+		min = math.Min(min, value)
+		max = math.Max(max, value)
+	}
+	mean /= float64(len(values))
+
+	stddev := 0.0
+	if len(values) > 1 {
+		for _, value := range values {
+			stddev += (value - mean) * (value - mean)
+		}
+		stddev = math.Sqrt(stddev / float64(len(values)-1))
+	}
+
+	return map[string]float64{
+		"mean":   mean,
+		"min":    min,
+		"max":    max,
+		"stddev": stddev,
+	}
+}
+
+// runConfigs initializes each configuration and runs the trace with it.
+// The runs are executed concurrently, with at most one run per CPU. It
+// returns the error of the first failing run, if any.
+func runConfigs(configs []cache.CacheConfig, traceFiles []string) error {
+	var wg sync.WaitGroup
+	slots := make(chan struct{}, runtime.NumCPU())
+	errs := make([]error, len(configs))
+	for i := range configs {
+		wg.Add(1)
+		go func(i int, config *cache.CacheConfig) {
+			defer wg.Done()
+			slots <- struct{}{}
+			defer func() { <-slots }()
+
+			if configErrs := cache.InitializeCaches(config); len(configErrs) > 0 {
+				errs[i] = cache.ConfigErrors(configErrs)
+				return
+			}
+			errs[i] = NewCacheSimulator(config).Run(traceFiles...)
+		}(i, &configs[i])
+	}
+	wg.Wait()
+
+	for _, err := range errs {
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// copyConfig returns a copy of a configuration that hasn't been
+// initialized, so that it can be initialized and run independently
+func copyConfig(config cache.CacheConfig) cache.CacheConfig {
+	config.Caches = append([]cache.Cache(nil), config.Caches...)
+	return config
+}
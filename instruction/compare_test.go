@@ -0,0 +1,104 @@
+package instruction
+
+// This file contains the tests of the comparisons between several runs of
+// the same trace
+
+import (
+	"math"
+	"reflect"
+	"testing"
+
+	"github.com/nsengupta5/Cache-Simulator/cache"
+)
+
+func TestComparePLRU(t *testing.T) {
+	config := cache.CacheConfig{
+		Caches: []cache.Cache{{Name: "L1", Size: 256, LineSize: 64, Kind: "full", PolicyName: "fifo"}},
+	}
+	comparison, err := ComparePolicies(config, []string{writeTrace(t, plruTrace...)}, PLRUPolicies, PLRUBaseline)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if baseline := comparison["baseline"]; baseline != "lru" {
+		t.Errorf("got baseline %v, want lru", baseline)
+	}
+
+	// The hits of each policy are the ones of TestPLRU, whatever the
+	// policy of the configuration
+	hits := map[string]int{"lru": 2, "plru_tree": 3, "plru_bit": 1}
+	policies := comparison["policies"].(map[string]interface{})
+	if len(policies) != len(hits) {
+		t.Errorf("got %d policies, want %d", len(policies), len(hits))
+	}
+	for policy, want := range hits {
+		results := policies[policy].(map[string]interface{})
+		stats := results["caches"].([]map[string]interface{})[0]
+		accesses := float64(len(plruTrace))
+		if stats["name"] != "L1" || stats["hits"] != want || stats["misses"] != len(plruTrace)-want {
+			t.Errorf("%s: got %v, want %d hits", policy, stats, want)
+		}
+		if difference := stats["hit_rate_difference"]; difference != float64(want)/accesses-float64(hits["lru"])/accesses {
+			t.Errorf("%s: got a hit rate difference of %v", policy, difference)
+		}
+		if memory := results["main_memory_accesses"]; memory != len(plruTrace)-want {
+			t.Errorf("%s: got %v memory accesses, want %d", policy, memory, len(plruTrace)-want)
+		}
+	}
+}
+
+func TestCompareSeeds(t *testing.T) {
+	// A loop over 6 lines on 4 lines evicted at random, so that the hit
+	// rate depends on the seed
+	trace := []string{}
+	for i := 0; i < 10; i++ {
+		trace = append(trace, readLines("0", "40", "80", "c0", "100", "140")...)
+	}
+	traceFile := writeTrace(t, trace...)
+	config := cache.CacheConfig{
+		Caches: []cache.Cache{{Name: "L1", Size: 256, LineSize: 64, Kind: "full", PolicyName: "random", Seed: 7}},
+	}
+
+	const runs = 5
+	summary, err := CompareSeeds(config, []string{traceFile}, runs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if summary["runs"] != runs {
+		t.Errorf("got %v runs, want %d", summary["runs"], runs)
+	}
+	stats := summary["caches"].([]map[string]interface{})[0]
+	seeds := []int64{7, 8, 9, 10, 11}
+	if !reflect.DeepEqual(stats["seeds"], seeds) {
+		t.Errorf("got seeds %v, want %v", stats["seeds"], seeds)
+	}
+
+	// Each run gives the hit rate of a single run with its seed
+	hitRates := []float64{}
+	for _, seed := range seeds {
+		run := copyConfig(config)
+		run.Caches[0].Seed = seed
+		runTrace(t, &run, trace...)
+		hitRates = append(hitRates, run.Caches[0].HitRate())
+	}
+	mean, min, max := 0.0, hitRates[0], hitRates[0]
+	for _, hitRate := range hitRates {
+		mean += hitRate / runs
+		min = math.Min(min, hitRate)
+		max = math.Max(max, hitRate)
+	}
+	if min == max {
+		t.Fatalf("every seed gives a hit rate of %v", min)
+	}
+	variance := 0.0
+	for _, hitRate := range hitRates {
+		variance += (hitRate - mean) * (hitRate - mean) / (runs - 1)
+	}
+
+	hitRate := stats["hit_rate"].(map[string]float64)
+	want := map[string]float64{"mean": mean, "min": min, "max": max, "stddev": math.Sqrt(variance)}
+	for name, value := range want {
+		if math.Abs(hitRate[name]-value) > 1e-12 {
+			t.Errorf("%s: got %v, want %v", name, hitRate[name], value)
+		}
+	}
+}
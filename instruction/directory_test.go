@@ -0,0 +1,145 @@
+package instruction
+
+// This file contains the tests of the sparse directory, run on two cores
+// with hand-checked traces
+
+import (
+	"testing"
+
+	"github.com/nsengupta5/Cache-Simulator/cache"
+)
+
+// The expected activity of a directory
+type directoryCounts struct {
+	lookups, used, peakUsed, evictions, invalidations, overflows, broadcasts, messages, snoopMessages int
+}
+
+func TestDirectory(t *testing.T) {
+	tests := []struct {
+		name      string
+		directory cache.DirectoryConfig
+		trace     []string
+		counts    directoryCounts
+		// The coherence misses of core 0 and the write-backs to memory
+		coherenceMisses  int
+		memoryWritebacks int
+	}{
+		{
+			// A single entry: tracking B evicts the entry of A, which
+			// invalidates the modified copy of core 0 and writes it back
+			// through the write-through L2. Reading A again is a
+			// coherence miss, and evicts the entry of B.
+			name:      "entry evictions",
+			directory: cache.DirectoryConfig{Entries: 1},
+			trace:     []string{"0 0 W 1 0", "0 40 R 1 0", "0 0 R 1 0"},
+			counts: directoryCounts{
+				lookups: 3, used: 1, peakUsed: 1, evictions: 2, invalidations: 2,
+				messages: 5, snoopMessages: 3,
+			},
+			coherenceMisses:  1,
+			memoryWritebacks: 1,
+		},
+		{
+			// C evicts A from the 2-line L1 of core 0, which releases the
+			// entry of A
+			name:      "release",
+			directory: cache.DirectoryConfig{Entries: 4},
+			trace:     []string{"0 0 R 1 0", "0 40 R 1 0", "0 80 R 1 0"},
+			counts: directoryCounts{
+				lookups: 3, used: 2, peakUsed: 3,
+				messages: 4, snoopMessages: 3,
+			},
+		},
+		{
+			// With a single pointer, the second sharer of A overflows its
+			// entry, and the upgrade of core 0 is broadcast to every core.
+			// Core 0 is then the only sharer again, until core 1 reads A,
+			// which core 0 writes back, and overflows the entry again.
+			name:      "limited pointer overflow",
+			directory: cache.DirectoryConfig{Entries: 4, Sharers: cache.LimitedPointer, Pointers: 1},
+			trace:     []string{"0 0 R 1 0", "0 0 R 1 1", "0 0 W 1 0", "0 0 R 1 1"},
+			counts: directoryCounts{
+				lookups: 4, used: 1, peakUsed: 1, overflows: 2, broadcasts: 1,
+				messages: 7, snoopMessages: 4,
+			},
+			memoryWritebacks: 1,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			config := newMultiCoreConfig()
+			config.Coherence = "mesi"
+			config.Caches[1].WritePolicy = cache.WriteThrough
+			config.DirectoryConfig = &test.directory
+			runTrace(t, config, test.trace...)
+
+			d := config.Directory
+			got := directoryCounts{
+				lookups:       d.Lookups,
+				used:          d.Used,
+				peakUsed:      d.PeakUsed,
+				evictions:     d.Evictions,
+				invalidations: d.Invalidations,
+				overflows:     d.Overflows,
+				broadcasts:    d.Broadcasts,
+				messages:      d.Messages,
+				snoopMessages: d.SnoopMessages,
+			}
+			if got != test.counts {
+				t.Errorf("got %+v, want %+v", got, test.counts)
+			}
+			if misses := config.CoherenceStats[0].CoherenceMisses; misses != test.coherenceMisses {
+				t.Errorf("coherence misses of core 0: got %d, want %d", misses, test.coherenceMisses)
+			}
+			if config.MemoryWritebacks != test.memoryWritebacks {
+				t.Errorf("memory write-backs: got %d, want %d", config.MemoryWritebacks, test.memoryWritebacks)
+			}
+		})
+	}
+}
+
+func TestDirectoryMatchesSnooping(t *testing.T) {
+	// A directory large enough to never evict an entry, with a bit vector
+	// per entry, sends every transaction to the cores that hold the line,
+	// which are the only ones a snooping bus changes
+	trace := []string{
+		"0 0 R 1 0", "0 0 R 1 1", "0 0 W 1 1", "0 40 W 1 0", "0 0 R 1 0",
+		"0 80 R 1 1", "0 40 R 1 1", "0 c0 W 1 0", "0 0 W 1 0", "0 40 R 1 0",
+		"0 80 W 1 0", "0 0 R 1 1", "0 c0 R 1 1", "0 100 R 1 0", "0 40 W 1 1",
+	}
+	for _, protocol := range []string{"mesi", "moesi"} {
+		snooping := newMultiCoreConfig()
+		snooping.Coherence = protocol
+		runTrace(t, snooping, trace...)
+
+		directory := newMultiCoreConfig()
+		directory.Coherence = protocol
+		directory.DirectoryConfig = &cache.DirectoryConfig{Entries: 64}
+		runTrace(t, directory, trace...)
+
+		for i := range snooping.Caches {
+			s, d := snooping.Caches[i], directory.Caches[i]
+			if s.Hits != d.Hits || s.Misses != d.Misses {
+				t.Errorf("%s %s core %d: snooping %d hits %d misses, directory %d hits %d misses",
+					protocol, s.Name, s.Core, s.Hits, s.Misses, d.Hits, d.Misses)
+			}
+		}
+		invalidations := 0
+		for core := range snooping.CoherenceStats {
+			s, d := snooping.CoherenceStats[core], directory.CoherenceStats[core]
+			invalidations += s.Invalidations
+			if s.Transactions != d.Transactions || s.Upgrades != d.Upgrades ||
+				s.Invalidations != d.Invalidations || s.Interventions != d.Interventions ||
+				s.Writebacks != d.Writebacks || s.CoherenceMisses != d.CoherenceMisses {
+				t.Errorf("%s core %d: snooping %+v, directory %+v", protocol, core, s, d)
+			}
+		}
+		if invalidations == 0 {
+			t.Errorf("%s: the trace invalidates no line", protocol)
+		}
+		if directory.Directory.Evictions != 0 {
+			t.Errorf("%s: got %d directory evictions, want none", protocol, directory.Directory.Evictions)
+		}
+	}
+}
@@ -0,0 +1,93 @@
+package instruction
+
+// This file contains the tests of the hierarchies split into first-level
+// instruction and data caches
+
+import (
+	"encoding/json"
+	"io"
+	"os"
+	"reflect"
+	"testing"
+
+	"github.com/nsengupta5/Cache-Simulator/cache"
+)
+
+// captureStdout returns what the given function prints to the standard
+// output
+func captureStdout(t *testing.T, print func()) string {
+	t.Helper()
+	reader, writer, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	stdout := os.Stdout
+	os.Stdout = writer
+	print()
+	os.Stdout = stdout
+	writer.Close()
+
+	output, err := io.ReadAll(reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(output)
+}
+
+func TestSplitL1(t *testing.T) {
+	// The fetches of A only go through the L1I and the data accesses
+	// through the L1D, so the read of A misses in the L1D and hits in the
+	// shared L2, where the first fetch of A filled it. The second fetch
+	// and read of A then hit in their own L1.
+	config := &cache.CacheConfig{
+		Caches: []cache.Cache{
+			{Name: "L1I", Size: 128, LineSize: 64, Kind: "full", Serves: cache.ServesInstructions, NextLevel: "L2"},
+			{Name: "L1D", Size: 128, LineSize: 64, Kind: "full", Serves: cache.ServesData, NextLevel: "L2"},
+			{Name: "L2", Size: 512, LineSize: 64, Kind: "full"},
+		},
+	}
+	runTrace(t, config,
+		"0 "+lineA+" I 4",
+		"0 "+lineA+" R 4",
+		"0 "+lineB+" W 4",
+		"0 "+lineA+" I 4",
+		"0 "+lineA+" R 4",
+	)
+
+	want := map[string]hitsMisses{
+		"L1I": {hits: 1, misses: 1},
+		"L1D": {hits: 1, misses: 2},
+		"L2":  {hits: 1, misses: 2},
+	}
+	for name, counts := range want {
+		c := cacheNamed(t, config, name)
+		if got := (hitsMisses{c.Hits, c.Misses}); got != counts {
+			t.Errorf("%s: got %+v, want %+v", name, got, counts)
+		}
+	}
+	if stats := config.CoreStats[0]; stats.Fetches != 2 || stats.Reads != 2 || stats.Writes != 1 {
+		t.Errorf("got %d fetches, %d reads and %d writes, want 2, 2 and 1", stats.Fetches, stats.Reads, stats.Writes)
+	}
+	if config.MemoryAccesses != 2 {
+		t.Errorf("got %d memory accesses, want 2", config.MemoryAccesses)
+	}
+
+	// The output reports the caches each kind of access goes through
+	type branch struct {
+		Serves string   `json:"serves"`
+		Caches []string `json:"caches"`
+	}
+	var stats struct {
+		Branches []branch `json:"branches"`
+	}
+	if err := json.Unmarshal([]byte(captureStdout(t, config.PrintStats)), &stats); err != nil {
+		t.Fatal(err)
+	}
+	branches := []branch{
+		{Serves: cache.ServesInstructions, Caches: []string{"L1I", "L2"}},
+		{Serves: cache.ServesData, Caches: []string{"L1D", "L2"}},
+	}
+	if !reflect.DeepEqual(stats.Branches, branches) {
+		t.Errorf("got branches %+v, want %+v", stats.Branches, branches)
+	}
+}
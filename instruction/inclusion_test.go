@@ -0,0 +1,95 @@
+package instruction
+
+// This file contains the tests of the inclusion policies of the hierarchy
+
+import (
+	"testing"
+
+	"github.com/nsengupta5/Cache-Simulator/cache"
+)
+
+// The lines of the hand-checked traces
+const (
+	lineA = "0"
+	lineB = "40"
+	lineC = "80"
+)
+
+// The expected hits and misses of a cache
+type hitsMisses struct {
+	hits, misses int
+}
+
+func TestInclusion(t *testing.T) {
+	// With 2-line LRU caches, C evicts B from the L1 and A from the L2, as
+	// the L2 doesn't see the hit on A. An inclusive L2 back-invalidates A,
+	// which is dirty in the L1, so the next access to A misses and A is
+	// written back to memory. An exclusive L2 only holds the L1 victims.
+	trace := []string{
+		"0 " + lineA + " W 1",
+		"0 " + lineB + " R 1",
+		"0 " + lineA + " R 1",
+		"0 " + lineC + " R 1",
+		"0 " + lineA + " R 1",
+		"0 " + lineB + " R 1",
+	}
+
+	tests := []struct {
+		inclusion         string
+		l1, l2            hitsMisses
+		backInvalidations int
+		memoryAccesses    int
+		memoryWritebacks  int
+	}{
+		{
+			inclusion:      cache.NINE,
+			l1:             hitsMisses{hits: 2, misses: 4},
+			l2:             hitsMisses{hits: 1, misses: 3},
+			memoryAccesses: 3,
+		},
+		{
+			inclusion:         cache.Inclusive,
+			l1:                hitsMisses{hits: 1, misses: 5},
+			l2:                hitsMisses{hits: 0, misses: 5},
+			backInvalidations: 1,
+			memoryAccesses:    5,
+			memoryWritebacks:  1,
+		},
+		{
+			inclusion:      cache.Exclusive,
+			l1:             hitsMisses{hits: 2, misses: 4},
+			l2:             hitsMisses{hits: 1, misses: 3},
+			memoryAccesses: 3,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.inclusion, func(t *testing.T) {
+			config := &cache.CacheConfig{
+				Inclusion: test.inclusion,
+				Caches: []cache.Cache{
+					{Name: "L1", Size: 128, LineSize: 64, Kind: "full", PolicyName: "lru"},
+					{Name: "L2", Size: 128, LineSize: 64, Kind: "full", PolicyName: "lru"},
+				},
+			}
+			runTrace(t, config, trace...)
+
+			l1, l2 := &config.Caches[0], &config.Caches[1]
+			if got := (hitsMisses{l1.Hits, l1.Misses}); got != test.l1 {
+				t.Errorf("L1: got %+v, want %+v", got, test.l1)
+			}
+			if got := (hitsMisses{l2.Hits, l2.Misses}); got != test.l2 {
+				t.Errorf("L2: got %+v, want %+v", got, test.l2)
+			}
+			if l1.BackInvalidations != test.backInvalidations {
+				t.Errorf("L1 back-invalidations: got %d, want %d", l1.BackInvalidations, test.backInvalidations)
+			}
+			if config.MemoryAccesses != test.memoryAccesses {
+				t.Errorf("memory accesses: got %d, want %d", config.MemoryAccesses, test.memoryAccesses)
+			}
+			if config.MemoryWritebacks != test.memoryWritebacks {
+				t.Errorf("memory write-backs: got %d, want %d", config.MemoryWritebacks, test.memoryWritebacks)
+			}
+		})
+	}
+}
@@ -6,32 +6,76 @@ package instruction
 
 import (
 	"bufio"
-	"math"
+	"fmt"
 	"os"
+	"strconv"
 	"strings"
 	"sync"
 
 	"github.com/nsengupta5/Cache-Simulator/cache"
-	"github.com/nsengupta5/Cache-Simulator/utils"
 )
 
 // bufferSize is the size of the buffer used to read the trace file
 const bufferSize int = 8000
 
+// The operations that can appear in the trace file. Instruction fetches
+// are reads served by the first-level cache serving instructions, which
+// is the same cache as for data accesses unless the L1 is split.
+const (
+	Read  rune = 'R'
+	Write rune = 'W'
+	Fetch rune = 'I'
+)
+
 type CacheLine = cache.CacheLine
 
+// The CacheInstruction struct represents an access of Size bytes
+// starting at Address by the instruction at PC, running on the given core
 type CacheInstruction struct {
-	Addresses []string
+	PC        uint64
+	Address   uint64
+	Size      int
+	Operation rune
+	Core      int
+	Timestamp uint64 // The time of the access, used to interleave the cores
+}
+
+// The coreStreams struct hands out the instructions of each core, read by
+// the goroutines reading the trace files. A shared trace file holds the
+// accesses of every core, and is read by one goroutine per core, each
+// skipping the lines of the other cores, so that a core running ahead of
+// the others never makes their instructions pile up in memory.
+type coreStreams struct {
+	channels []chan CacheInstruction // The instructions of each core
+}
+
+// The request struct represents a line that has already been requested
+// from a cache level while executing the current instruction
+type request struct {
+	address uint64
+	write   bool
 }
 
 type CacheSimulator struct {
 	Config *cache.CacheConfig
+
+	addressMask uint64      // Selects the bits of the address space
+	requested   [][]request // The lines requested from each level by the current instruction
+	clock       uint64      // The number of instructions executed so far
+	pc          uint64      // The PC of the current instruction
+	core        int         // The core running the current instruction
+	firstLevel  int         // The first level accessed by the current instruction
+	supplied    bool        // Whether another core supplies the coherent line being accessed
+	line        uint64      // The address of the coherent line being accessed
+	prefetching bool        // Whether the current accesses fill a prefetched line
 }
 
 // NewCacheSimulator creates a new cache simulator
 func NewCacheSimulator(config *cache.CacheConfig) *CacheSimulator {
 	return &CacheSimulator{
-		Config: config,
+		Config:      config,
+		addressMask: config.AddressMask(),
+		requested:   make([][]request, len(config.Caches)),
 	}
 }
 
@@ -47,168 +91,867 @@ func NewCacheSimulator(config *cache.CacheConfig) *CacheSimulator {
 // the instructions, reducing the time taken by up to around 50%.
 // The buffer size is used to read the trace file concurrently, and
 // has been experimentally determined to be the optimal size.
-func (cs *CacheSimulator) Execute(traceFile string) {
+func (cs *CacheSimulator) Execute(traceFiles ...string) error {
+	if err := cs.Run(traceFiles...); err != nil {
+		return err
+	}
+	cs.Config.PrintStats()
+	return nil
+}
+
+// Run reads the trace files and executes the instructions, leaving the
+// cache statistics in the configuration of the simulator. A multi-core
+// configuration takes either a single trace file holding the accesses of
+// every core, or one trace file per core. It returns an error if the trace
+// files can't be read or hold an invalid line.
+func (cs *CacheSimulator) Run(traceFiles ...string) error {
+	if cores := cs.Config.Cores; len(traceFiles) != 1 && len(traceFiles) != cores {
+		return fmt.Errorf("expected 1 trace file or 1 per core (%d), got %d", cores, len(traceFiles))
+	}
+
+	// The optimal policy needs a pre-pass over the trace to know the
+	// future accesses of every line
+	if err := cs.recordOracles(traceFiles); err != nil {
+		return err
+	}
+
+	return cs.readTraces(traceFiles, cs.executeInstruction)
+}
 
+// readTraces reads the trace files and passes each instruction to the given
+// function, in the order given by the interleaving of the cores. It returns
+// the first error found in the trace files, in which case the reading stops.
+func (cs *CacheSimulator) readTraces(traceFiles []string, handle func(CacheInstruction)) error {
 	// WaitGroups are used to wait for the goroutines to finish
 	// This is necessary because we are using goroutines to read
-	// the trace file and execute the instructions concurrently,
+	// the trace files and execute the instructions concurrently,
 	// so we must ensure all processing is complete before printing
 	// the cache statistics
 	var wg sync.WaitGroup
 
-	// The instructions channel is used to send the cache instructions
-	// to the goroutine that executes the instructions.
-	instructions := make(chan CacheInstruction, bufferSize)
-
-	// The wait group is incremented to wait for the goroutine that
-	// reads the trace file to finish and execute the instructions
-	wg.Add(1)
-
-	// The goroutine reads the trace file and sends the instructions
-	go func() {
-		// Defer the Done call to ensure the wait group is decremented,
-		// so that the main goroutine can continue
-		defer wg.Done()
-		file, err := os.Open(traceFile)
-		utils.Check(err)
-		defer file.Close()
-
-		scanner := bufio.NewScanner(file)
-		for scanner.Scan() {
-			instruction := scanner.Text()
-			instructionArr := strings.Split(instruction, " ")
-			memAddress := utils.ConvertHexToBinary(instructionArr[1])
-			size := utils.ConvertStringToInt(instructionArr[3])
-
-			// Use the first cache to calculate the offset and affected addresses
-			l1 := cs.Config.Caches[0]
-			offset := utils.GetOffset(l1.TagSize, l1.IndexSize, memAddress)
-			addresses := getAffectedAddresses(size, l1.LineSize, offset, memAddress)
-			instructions <- CacheInstruction{Addresses: addresses}
-		}
-		// Close the instructions channel to signal that all instructions
-		// have been sent
-		close(instructions)
-	}()
-
-	// The wait group is incremented to wait for the goroutine that
-	// executes the instructions to finish
-	wg.Add(1)
-	go func() {
-		defer wg.Done()
-		for instruction := range instructions {
-			cs.executeInstruction(instruction)
-		}
-	}()
-
-	// Wait for the goroutines to finish before printing the cache
+	// The done channel is closed by the first goroutine finding an error,
+	// so that the others stop reading
+	done := make(chan struct{})
+	var stop sync.Once
+	cores := cs.Config.Cores
+	errs := make([]error, cores)
+
+	// The instructions channel of each core is used to send its cache
+	// instructions to the goroutine that executes the instructions. The
+	// channels are buffered, so that at most bufferSize instructions of
+	// each core are read ahead.
+	channels := make([]chan CacheInstruction, cores)
+	shared := len(traceFiles) == 1
+	for core := range channels {
+		instructions := make(chan CacheInstruction, bufferSize)
+		channels[core] = instructions
+		file, fileCore := traceFiles[0], 0
+		if !shared {
+			file, fileCore = traceFiles[core], core
+		}
+
+		// The wait group is incremented to wait for the goroutine that
+		// reads the file to finish
+		wg.Add(1)
+
+		// The goroutine reads the file and sends the instructions of the
+		// core. A file per core holds the accesses of the core with its
+		// index.
+		go func(core int, file string, fileCore int) {
+			// Defer the Done call to ensure the wait group is decremented,
+			// so that the main goroutine can continue
+			defer wg.Done()
+
+			// Close the instructions channel to signal that all instructions
+			// have been sent
+			defer close(instructions)
+
+			errs[core] = cs.readTrace(file, fileCore, shared, func(instruction CacheInstruction) bool {
+				if instruction.Core != core {
+					return true
+				}
+				select {
+				case instructions <- instruction:
+					return true
+				case <-done:
+					return false
+				}
+			})
+			if errs[core] != nil {
+				stop.Do(func() { close(done) })
+			}
+		}(core, file, fileCore)
+	}
+
+	// The instructions are executed as they arrive, and the files are
+	// read until every one of them is closed
+	cs.interleave(&coreStreams{channels: channels}, handle)
+
+	// Wait for the goroutines to finish before returning the cache
 	// statistics
 	wg.Wait()
-	cs.Config.PrintStats()
+	for _, err := range errs {
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// next returns the next instruction of the given core, and false once the
+// stream of the core has ended
+func (streams *coreStreams) next(core int) (CacheInstruction, bool) {
+	instruction, ok := <-streams.channels[core]
+	return instruction, ok
+}
+
+// interleave passes the instructions of the cores to the given function.
+// With round-robin interleaving, every core executes one instruction in
+// turn, skipping the cores whose stream has ended. With timestamp
+// interleaving, the instruction with the earliest timestamp goes first,
+// the lowest core winning ties. Both orders only depend on the streams,
+// so that runs are reproducible.
+func (cs *CacheSimulator) interleave(streams *coreStreams, handle func(CacheInstruction)) {
+	cores := cs.Config.Cores
+	open := make([]bool, cores)
+	next := make([]CacheInstruction, cores)
+	for core := range next {
+		next[core], open[core] = streams.next(core)
+	}
+
+	core := 0
+	for {
+		if cs.Config.Interleave == cache.Timestamp {
+			core = -1
+			for i := range next {
+				if open[i] && (core < 0 || next[i].Timestamp < next[core].Timestamp) {
+					core = i
+				}
+			}
+		} else {
+			for i := 0; i < cores && !open[core]; i++ {
+				core = (core + 1) % cores
+			}
+		}
+		if core < 0 || !open[core] {
+			return
+		}
+
+		handle(next[core])
+		next[core], open[core] = streams.next(core)
+		if cs.Config.Interleave != cache.Timestamp {
+			core = (core + 1) % cores
+		}
+	}
+}
+
+// readTrace reads a trace file and passes each instruction to the given
+// function, in the order of the trace, until the function returns false.
+// Each line holds the PC, address, operation and size of an access,
+// optionally followed by the core making it and the timestamp of the
+// access. The core of the lines of a trace file per core is the given
+// core, which is also the default core of the lines of a shared trace
+// file, core 0. The timestamp of a line defaults to its line number. It
+// returns an error if the file can't be read or a line is invalid.
+func (cs *CacheSimulator) readTrace(traceFile string, core int, shared bool, handle func(CacheInstruction) bool) error {
+	file, err := os.Open(traceFile)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	lineNumber := 0
+	for scanner.Scan() {
+		lineNumber++
+		instruction := scanner.Text()
+		instructionArr := strings.Split(instruction, " ")
+		if len(instructionArr) < 4 {
+			return fmt.Errorf("%s:%d: expected the PC, address, operation and size of an access, got %q",
+				traceFile, lineNumber, instruction)
+		}
+		fail := func(format string, args ...interface{}) error {
+			return fmt.Errorf("%s:%d: "+format, append([]interface{}{traceFile, lineNumber}, args...)...)
+		}
+		pc, err := strconv.ParseUint(instructionArr[0], 16, 64)
+		if err != nil {
+			return fail("invalid PC %q, expected a hexadecimal address", instructionArr[0])
+		}
+
+		// An address wider than the configured address size would alias
+		// the line of another address if its upper bits were dropped
+		memAddress, err := strconv.ParseUint(instructionArr[1], 16, 64)
+		if err != nil {
+			return fail("invalid address %q, expected a hexadecimal address of up to 64 bits", instructionArr[1])
+		}
+		if memAddress&^cs.addressMask != 0 {
+			return fail("address %s is wider than the %d address bits", instructionArr[1], cs.Config.AddressBits)
+		}
+		var operation rune
+		switch instructionArr[2] {
+		case string(Read), string(Write), string(Fetch):
+			operation = rune(instructionArr[2][0])
+		default:
+			return fail("unknown operation %q, expected %c, %c or %c", instructionArr[2], Read, Write, Fetch)
+		}
+		size, err := strconv.Atoi(instructionArr[3])
+		if err != nil || size <= 0 {
+			return fail("invalid size %q, expected a positive number of bytes", instructionArr[3])
+		}
+
+		lineCore := core
+		if len(instructionArr) > 4 && shared {
+			lineCore, err = strconv.Atoi(instructionArr[4])
+			if err != nil || lineCore < 0 || lineCore >= cs.Config.Cores {
+				return fail("unknown core %q, the configuration has %d cores", instructionArr[4], cs.Config.Cores)
+			}
+		}
+		timestamp := uint64(lineNumber)
+		if len(instructionArr) > 5 {
+			timestamp, err = strconv.ParseUint(instructionArr[5], 10, 64)
+			if err != nil {
+				return fail("invalid timestamp %q, expected a non-negative integer", instructionArr[5])
+			}
+		}
+
+		if !handle(CacheInstruction{
+			PC:        pc,
+			Address:   memAddress,
+			Size:      size,
+			Operation: operation,
+			Core:      lineCore,
+			Timestamp: timestamp,
+		}) {
+			return nil
+		}
+	}
+	return scanner.Err()
+}
+
+// recordOracles records the accesses of the trace in the oracles of the
+// caches using the optimal policy. Each oracle only records the accesses
+// going through its cache, instruction fetches and data accesses being
+// served by different caches in a split hierarchy, and each core having
+// its own private caches. The trace is only recorded once for the caches
+// seeing the same accesses with the same line size, which share the
+// records.
+func (cs *CacheSimulator) recordOracles(traceFiles []string) error {
+	type oracleKey struct {
+		lineSize int
+		sources  string
+	}
+	oracles := map[oracleKey]*cache.Oracle{}
+	sources := map[*cache.Oracle][]bool{}
+	for i, c := range cs.Config.Caches {
+		if c.Oracle == nil {
+			continue
+		}
+		reached := cs.sources(i)
+		key := oracleKey{lineSize: c.LineSize, sources: fmt.Sprint(reached)}
+		if oracle, exists := oracles[key]; exists {
+			c.Oracle.Share(oracle)
+		} else {
+			oracles[key] = c.Oracle
+			sources[c.Oracle] = reached
+		}
+	}
+	if len(oracles) == 0 {
+		return nil
+	}
+
+	// The times match the clock of the simulator, which is incremented
+	// before each instruction is executed
+	var time uint64
+	return cs.readTraces(traceFiles, func(instruction CacheInstruction) {
+		time++
+		source := sourceIndex(instruction.Core, instruction.Operation == Fetch)
+		for oracle, reached := range sources {
+			if reached[source] {
+				oracle.Record(time, instruction.Address, instruction.Size)
+			}
+		}
+	})
+}
+
+// sources returns, for every core, whether its data accesses and its
+// instruction fetches go through the cache at the given level, indexed
+// by sourceIndex
+func (cs *CacheSimulator) sources(level int) []bool {
+	reached := make([]bool, 2*cs.Config.Cores)
+	for core := 0; core < cs.Config.Cores; core++ {
+		for _, fetch := range []bool{false, true} {
+			reached[sourceIndex(core, fetch)] = cs.Config.Reaches(core, fetch, level)
+		}
+	}
+	return reached
+}
+
+// sourceIndex returns the index of the data accesses or instruction
+// fetches of a core in the sources of a cache
+func sourceIndex(core int, fetch bool) int {
+	if fetch {
+		return 2*core + 1
+	}
+	return 2 * core
 }
 
 // executeInstruction executes the given cache instruction
-// It loops over all the addresses in the instruction and
-// calls handleCacheOperations to check if the data is present
-// in the cache and updates the cache statistics accordingly
+// It calls handleCacheOperations with the bytes accessed by the
+// instruction, which checks if the data is present in the caches
+// and updates the cache statistics accordingly
 func (cs *CacheSimulator) executeInstruction(instruction CacheInstruction) {
-	for i := 0; i < len(instruction.Addresses); i++ {
-		if !cs.handleCacheOperations(instruction.Addresses[i]) {
+	for i := range cs.requested {
+		cs.requested[i] = cs.requested[i][:0]
+	}
+	cs.clock++
+	cs.pc = instruction.PC
+	cs.core = instruction.Core
+
+	coreStats := &cs.Config.CoreStats[cs.core]
+	coreStats.Instructions++
+	switch instruction.Operation {
+	case Write:
+		coreStats.Writes++
+	case Fetch:
+		coreStats.Fetches++
+	default:
+		coreStats.Reads++
+	}
+
+	write := instruction.Operation == Write
+	cs.firstLevel = cs.Config.FirstLevel(cs.core, instruction.Operation == Fetch)
+	cs.handleCacheOperations(instruction.Address, instruction.Size, write, cs.firstLevel)
+}
+
+// handleCacheOperations accesses the given bytes in the cache at the given
+// level. Each level sees the access at its own line granularity: if the
+// bytes span several lines of the cache, each line is accessed in turn.
+// Once past the last level, the access goes to main memory.
+func (cs *CacheSimulator) handleCacheOperations(address uint64, size int, write bool, level int) {
+	if level == len(cs.Config.Caches) {
+		if write {
+			cs.Config.MemoryWrites++
+			cs.Config.MemoryWriteBytes += size
+		} else {
 			cs.Config.MemoryAccesses++
+			cs.Config.MemoryBytes += size
+			cs.Config.CoreStats[cs.core].MemoryAccesses++
 		}
+		return
 	}
-}
 
-// handleCacheOperations checks if the data is present in the cache
-// If not, it fetches it from memory and updates the cache statistics
-// It returns a boolean indicating if the data was found in the cache
-func (cs *CacheSimulator) handleCacheOperations(address string) bool {
-	var dataFound bool = false
-	var tag int
-	var index int
+	cache := &cs.Config.Caches[level]
+	for size > 0 {
+		// The part of the access that falls within the current line
+		lineAddress := cache.GetLineAddress(address)
+		chunk := cache.LineSize - int(address-lineAddress)
+		if chunk > size {
+			chunk = size
+		}
 
-	// For each address, we loop over all caches to check if the data
-	// is present
-	for j := 0; j < len(cs.Config.Caches); j++ {
-		cache := cs.Config.Caches[j]
-		index, tag, _ = utils.GetMemoryInfo(
-			cache.TagSize,
-			cache.IndexSize,
-			cache.Kind,
-			address,
-		)
+		// If a line of a lower level is larger than the lines above it, it
+		// can be requested several times by the same instruction. The first
+		// request already brought it into the cache, so the others are not
+		// counted, but the bytes of each write still have to be written.
+		if cs.markRequested(level, lineAddress, write) {
+			var hit bool
+			if level == cs.firstLevel && cs.Config.IsCoherent(level) {
+				hit = cs.handleCoherentLine(address, chunk, write, level)
+			} else {
+				hit = cs.handleLineOperation(address, chunk, write, level)
+			}
+			if cache.Prefetcher != nil && !cs.prefetching {
+				cs.prefetch(address, hit, level)
+			}
+		} else if write {
+			cs.writeRequested(address, chunk, level)
+		}
+
+		address = (address + uint64(chunk)) & cs.addressMask
+		size -= chunk
+	}
+}
 
-		hit, line := cache.CheckHitOrMiss(tag, index)
-		set := cache.Sets[index]
+// handleLineOperation checks if the line holding the given bytes is
+// present in the cache at the given level. If not, it fetches the whole
+// line from the next level and updates the cache statistics. Writes are
+// handled according to the write policy and write miss policy of the cache.
+// It returns a boolean indicating if the line was found in the cache.
+func (cs *CacheSimulator) handleLineOperation(address uint64, size int, write bool, level int) bool {
+	cache := &cs.Config.Caches[level]
+	lineAddress := cache.GetLineAddress(address)
 
-		// If the data is found in the cache, we update the cache statistics
-		// If the cache has a policy, we also update the policy statistics
-		// i.e the frequency and age of the line for LFU and LRU policies
-		// respectively. We break out of the loop as we don't need to check
-		// the other caches if a hit is found.
+	index, tag, _ := cache.GetMemoryInfo(address)
+	hit, line := cache.CheckHitOrMiss(tag, index)
+	set := cache.Sets[index]
+
+	// The fill of a line prefetched by a level above isn't a demand
+	// access, so it is counted apart from the demand statistics
+	if cs.prefetching {
 		if hit {
-			cs.Config.Caches[j].Hits++
-			set.Policy.Update(line)
-			dataFound = true
-			break
+			cache.PrefetchHits++
+			set.Policy.Update(line, cs.access(lineAddress))
 		} else {
-			// If the data is not found in the cache, we update the cache
-			// miss statistics and assign a new cache line to the data.
-			// Depending on the cache kind, we either insert the data directly
-			// or use the cache policy to insert the data.
-			cs.Config.Caches[j].Misses++
-
-			// A new cache line will have 1 frequency and 0 age,
-			// where Freq represents the number of times the line
-			// has been accessed and Age represents the number of
-			// instructions since the line was last accessed.
-			data := &CacheLine{
-				Tag:   tag,
-				Valid: true,
-				Index: -1,
-				Freq:  1,
-				Prev:  nil,
-				Next:  nil,
-			}
-			if cache.Kind == "direct" {
-				set.Lines[0] = *data
-			} else {
-				set.Insert(data)
+			cache.PrefetchMisses++
+			cs.fetchLine(lineAddress, false, level)
+		}
+		return hit
+	}
+
+	if write {
+		cache.Writes++
+	} else {
+		cache.Reads++
+	}
+	if cache.Classifier != nil {
+		cache.Classifier.Access(lineAddress, hit)
+	}
+	if cache.SharedStats != nil {
+		cs.countSharedAccess(cache, hit)
+	}
+
+	// If the data is found in the cache, we update the cache statistics
+	// If the cache has a policy, we also update the policy statistics
+	// i.e the frequency and age of the line for LFU and LRU policies
+	// respectively. We don't need to check the other caches if a hit
+	// is found, unless the write has to be forwarded.
+	if hit {
+		cache.Hits++
+		set.Policy.Update(line, cs.access(lineAddress))
+
+		// The first demand access to a prefetched line makes the prefetch
+		// useful. If the prefetch hasn't completed yet, it was late.
+		if line.Prefetched {
+			cache.UsefulPrefetches++
+			if cs.clock < line.ReadyAt {
+				cache.LatePrefetches++
+			}
+			line.Prefetched = false
+		}
+
+		if write {
+			cs.performWrite(line, address, size, level)
+		}
+		return true
+	}
+
+	// If the data is not found in the cache, we update the cache
+	// miss statistics and assign a new cache line to the data.
+	cache.Misses++
+
+	// A no-write-allocate cache doesn't fill the line on a write
+	// miss, the write is simply passed on to the next level
+	if write && !cache.IsWriteAllocate() {
+		cs.handleCacheOperations(address, size, true, cache.Next)
+		return false
+	}
+
+	// The write is then performed on the allocated line
+	line = cs.fetchLine(lineAddress, false, level)
+	if write {
+		cs.performWrite(line, address, size, level)
+	}
+	return false
+}
+
+// handleCoherentLine accesses a line of a private cache kept coherent by
+// the coherence protocol. The core first broadcasts the transaction the
+// state of the line in its private caches requires, if any. The dirty
+// lines other cores have to write back go to the shared levels, and a line
+// another core supplies doesn't have to be fetched from them. The line is
+// then accessed as usual, and every copy of it in the private caches of
+// the core moves to its new state. It returns a boolean indicating if the
+// line was found in the cache.
+func (cs *CacheSimulator) handleCoherentLine(address uint64, size int, write bool, level int) bool {
+	config := cs.Config
+	lineSize := config.Caches[level].LineSize
+	lineAddress := config.Caches[level].GetLineAddress(address)
+
+	state, transaction := config.Request(cs.core, lineAddress, write)
+	shared := false
+	if transaction != cache.NoTransaction {
+		result := config.Snoop(cs.core, lineAddress, transaction)
+		for _, writeback := range result.Writebacks {
+			cs.writeBack(writeback.Address, lineSize, config.SharedLevel(writeback.Core))
+		}
+		shared = result.Shared
+		cs.supplied, cs.line = result.Supplied, lineAddress
+	}
+
+	hit := cs.handleLineOperation(address, size, write, level)
+	cs.supplied = false
+	config.SetCoherenceState(cs.core, lineAddress, config.Protocol.Next(state, write, shared))
+
+	// A core that didn't keep the line, such as after a write miss in a
+	// no-write-allocate cache, is no longer one of its sharers
+	if transaction != cache.NoTransaction {
+		config.ReleaseLine(cs.core, lineAddress)
+	}
+	return hit
+}
+
+// isSupplied returns true if the line at the given address, missing from
+// the cache at the given level, is supplied by another core instead of
+// the next level, which is the case once the miss leaves the private
+// caches of the core
+func (cs *CacheSimulator) isSupplied(lineAddress uint64, level int) bool {
+	next := cs.Config.Caches[level].Next
+	if !cs.supplied || lineAddress != cs.line {
+		return false
+	}
+	return next == len(cs.Config.Caches) || !cs.Config.Caches[next].Private
+}
+
+// fetchLine brings the line at the given address into the cache at the
+// given level and returns it. In an exclusive hierarchy, the line moves up
+// from the level holding it. Otherwise, the line is allocated first and the
+// whole line is then fetched from the next level, which only supplies the
+// data, so it sees a read, unless another core supplies the line on the
+// bus. A cache with a victim cache checks it first.
+func (cs *CacheSimulator) fetchLine(lineAddress uint64, prefetch bool, level int) *CacheLine {
+	// A line held by the victim cache is swapped with the line the cache
+	// evicts for it, without going to the next level
+	cache := &cs.Config.Caches[level]
+	if cache.Victim != nil {
+		if victim, found := cache.TakeVictim(lineAddress); found {
+			index, _, _ := cache.GetMemoryInfo(lineAddress)
+			if !cs.prefetching {
+				cache.VictimHits++
+				if cache.IsSetFull(index) {
+					cache.VictimSwaps++
+				}
 			}
+			return cs.fillLine(lineAddress, victim.Dirty, prefetch, level)
 		}
 	}
-	return dataFound
+
+	if cs.Config.IsExclusive() {
+		dirty := cs.fetchExclusive(lineAddress, cache.LineSize, cache.Next)
+		return cs.fillLine(lineAddress, dirty, prefetch, level)
+	}
+
+	line := cs.fillLine(lineAddress, false, prefetch, level)
+	if !cs.isSupplied(lineAddress, level) {
+		cs.handleCacheOperations(lineAddress, cache.LineSize, false, cache.Next)
+	}
+	return line
 }
 
-// getAffectedAddresses returns the addresses affected by the operation
-// If the size of the operation is larger than the line size, we will
-// have to handle multiple cache operations. The length of the addresses
-// array indicates the number of cache operations we need to handle.
-func getAffectedAddresses(size int, lineSize int, offset int, memAddress string) []string {
-	memAddressInt := utils.ConvertBinaryToInt(memAddress)
-	addresses := []string{memAddress}
+// prefetch passes a demand access to the given level to the prefetcher of
+// the cache, and brings the lines it predicts into the cache. The fills
+// of the prefetched lines are counted as prefetch traffic by the levels
+// below, and don't train their own prefetchers.
+func (cs *CacheSimulator) prefetch(address uint64, hit bool, level int) {
+	cache := &cs.Config.Caches[level]
+	cs.prefetching = true
+	defer func() { cs.prefetching = false }()
+
+	for _, prefetchAddress := range cache.Prefetcher.Access(cs.pc, address, hit) {
+		lineAddress := cache.GetLineAddress(prefetchAddress & cs.addressMask)
+		index, tag, _ := cache.GetMemoryInfo(lineAddress)
+		if present, _ := cache.CheckHitOrMiss(tag, index); present {
+			continue
+		}
+
+		cache.PrefetchesIssued++
+		cs.fetchLine(lineAddress, true, level)
+	}
+}
+
+// fillLine allocates the line holding the given address in the cache at
+// the given level and handles the line it replaces, if any. It returns
+// the allocated line. Lines allocated by a prefetch only become available
+// once the prefetch latency has elapsed.
+func (cs *CacheSimulator) fillLine(address uint64, dirty bool, prefetch bool, level int) *CacheLine {
+	cache := &cs.Config.Caches[level]
+	index, tag, _ := cache.GetMemoryInfo(address)
+	set := cache.Sets[index]
+
+	// A new cache line will have 1 frequency and 0 age,
+	// where Freq represents the number of times the line
+	// has been accessed and Age represents the number of
+	// instructions since the line was last accessed.
+	data := &CacheLine{
+		Tag:        tag,
+		Valid:      true,
+		Dirty:      dirty,
+		Prefetched: prefetch,
+		Index:      -1,
+		Freq:       1,
+		Owner:      cs.core,
+		Prev:       nil,
+		Next:       nil,
+	}
+	if prefetch {
+		data.ReadyAt = cs.clock + uint64(cache.PrefetcherConfig.Latency)
+	}
 
-	// We first calculate the initial address. If the size of the operation
-	// is larger than the line size, we will have to handle multiple cache
-	// operations. Otherwise, we only need to handle one cache operation.
-	initialBytes := lineSize - offset
-	if size <= initialBytes {
-		return addresses
+	// Depending on the cache kind, we either insert the data directly
+	// or use the cache policy to insert the data.
+	var line *CacheLine
+	var evicted CacheLine
+	var wasEvicted bool
+	if cache.IsDirectMapped() {
+		evicted, wasEvicted = set.Lines[0], set.Lines[0].Valid
+		data.Index = 0
+		set.Lines[0] = *data
+		line = &set.Lines[0]
+	} else {
+		evicted, wasEvicted = set.Insert(data, cs.access(cache.GetLineAddress(address)))
+		line = &set.Lines[data.Index]
 	}
 
-	remainingBytes := size - initialBytes
-	// We calculate the number of remaining addresses we need to handle
-	// based on the remaining bytes and the line size
-	// The ceil function is used to round up the number of addresses
-	// as we can't have a fraction of an address
-	remainingAddresses := int(math.Ceil(float64(remainingBytes) / float64(lineSize)))
+	if wasEvicted {
+		// A prefetched line evicted before being used was useless, and a
+		// demand line evicted to make room for a prefetch is pollution
+		if evicted.Prefetched {
+			cache.UselessPrefetches++
+		} else if prefetch {
+			cache.PollutionEvictions++
+		}
+
+		// A core evicting a line brought into a shared cache by another
+		// core is interfering with it
+		if cache.SharedStats != nil && evicted.Owner != cs.core {
+			cache.InterCoreEvictions++
+			cache.SharedStats[evicted.Owner].InterCoreEvictions++
+		}
+		evictedAddress := cache.GetAddress(evicted.Tag, index)
+		cs.evictLine(evictedAddress, evicted.Dirty, level)
 
-	// We then calculate the remaining addresses and append them to the
-	// addresses array
-	for i := 1; i <= remainingAddresses; i++ {
-		address := memAddressInt + (i * lineSize)
-		addresses = append(addresses, utils.ConvertIntToBinary(address))
+		// The directory stops tracking a core that no longer holds the line
+		if cs.Config.IsCoherent(level) {
+			cs.Config.ReleaseLine(cache.Core, evictedAddress)
+		}
 	}
+	return line
+}
 
-	return addresses
+// evictLine handles a line evicted from the cache at the given level
+// according to the inclusion policy of the hierarchy. A dirty line has
+// to be written back to the next level before it is replaced. If the
+// cache has a victim cache, the line goes there instead, and the line
+// the victim cache evicts, if any, leaves the level.
+func (cs *CacheSimulator) evictLine(address uint64, dirty bool, level int) {
+	cache := &cs.Config.Caches[level]
+	if cache.Victim != nil {
+		evicted, evictedAddress, wasEvicted := cache.PutVictim(address, dirty, cs.access(address))
+		if !wasEvicted {
+			return
+		}
+		address, dirty = evictedAddress, evicted.Dirty
+	}
+
+	switch {
+	case cs.Config.IsInclusive():
+		// The levels above can't keep a line this level no longer holds.
+		// Their copy may be more recent, in which case it is written back.
+		if cs.backInvalidate(address, cache.LineSize, level) {
+			dirty = true
+		}
+	case cs.Config.IsExclusive():
+		// The victim moves down to the next level, or to memory if dirty
+		if dirty {
+			cache.DirtyEvictions++
+		}
+		if cache.Next < len(cs.Config.Caches) {
+			cs.fillLine(address, dirty, false, cache.Next)
+		} else if dirty {
+			cs.Config.MemoryWritebacks++
+			cs.Config.MemoryWriteBytes += cache.LineSize
+		}
+		return
+	}
+
+	if dirty {
+		cache.DirtyEvictions++
+		cs.writeBack(address, cache.LineSize, cache.Next)
+	}
+}
+
+// backInvalidate invalidates the given bytes in every level above the
+// given level, including their victim caches. It returns true if any of
+// the invalidated lines was dirty.
+func (cs *CacheSimulator) backInvalidate(address uint64, size int, level int) bool {
+	dirty := false
+	for _, j := range cs.Config.Above(level) {
+		cache := &cs.Config.Caches[j]
+		end := address + uint64(size)
+		for lineAddress := cache.GetLineAddress(address); lineAddress < end; lineAddress += uint64(cache.LineSize) {
+			index, tag, _ := cache.GetMemoryInfo(lineAddress)
+			if line, found := cache.Invalidate(tag, index); found {
+				cache.BackInvalidations++
+				if line.Prefetched {
+					cache.UselessPrefetches++
+				}
+				dirty = dirty || line.Dirty
+				if cs.Config.IsCoherent(j) {
+					cs.Config.ReleaseLine(cache.Core, lineAddress)
+				}
+			}
+			if cache.Victim == nil {
+				continue
+			}
+			if line, found := cache.TakeVictim(lineAddress); found {
+				cache.BackInvalidations++
+				dirty = dirty || line.Dirty
+			}
+		}
+	}
+	return dirty
+}
+
+// fetchExclusive looks for a line of the given size in the levels starting
+// from the given level of an exclusive hierarchy. The line is removed from
+// the level holding it, as it moves up to the level that missed. If no
+// level holds it, it is read from memory. It returns true if the line was
+// dirty.
+func (cs *CacheSimulator) fetchExclusive(lineAddress uint64, lineSize int, level int) bool {
+	for j := level; j < len(cs.Config.Caches); j = cs.Config.Caches[j].Next {
+		cache := &cs.Config.Caches[j]
+		index, tag, _ := cache.GetMemoryInfo(lineAddress)
+
+		line, found := cache.Invalidate(tag, index)
+		victimHit := false
+		if !found && cache.Victim != nil {
+			line, found = cache.TakeVictim(lineAddress)
+			victimHit = found
+		}
+
+		// The line moving up for a prefetch is counted apart from the
+		// demand statistics
+		if cs.prefetching {
+			if found {
+				cache.PrefetchHits++
+				return line.Dirty
+			}
+			cache.PrefetchMisses++
+			continue
+		}
+
+		cache.Reads++
+		if victimHit {
+			cache.VictimHits++
+		}
+		if cache.Classifier != nil {
+			cache.Classifier.Access(lineAddress, found)
+		}
+		if cache.SharedStats != nil {
+			cs.countSharedAccess(cache, found)
+		}
+		if found {
+			cache.Hits++
+			if line.Prefetched {
+				cache.UsefulPrefetches++
+			}
+			return line.Dirty
+		}
+		cache.Misses++
+	}
+
+	cs.Config.MemoryAccesses++
+	cs.Config.MemoryBytes += lineSize
+	cs.Config.CoreStats[cs.core].MemoryAccesses++
+	return false
+}
+
+// countSharedAccess counts an access of the current core to a cache
+// shared by several cores
+func (cs *CacheSimulator) countSharedAccess(cache *cache.Cache, hit bool) {
+	if hit {
+		cache.SharedStats[cs.core].Hits++
+	} else {
+		cache.SharedStats[cs.core].Misses++
+	}
+}
+
+// access returns the description of the current access to the line at
+// the given address, which is passed to the replacement policies
+func (cs *CacheSimulator) access(lineAddress uint64) cache.Access {
+	return cache.Access{
+		Time:    cs.clock,
+		Address: lineAddress,
+		PC:      cs.pc,
+	}
+}
+
+// performWrite writes the given bytes to a line of the cache at the given
+// level. A write-back cache marks the line as dirty, whereas a
+// write-through cache forwards the write to the next level.
+func (cs *CacheSimulator) performWrite(line *CacheLine, address uint64, size int, level int) {
+	if cache := &cs.Config.Caches[level]; cache.IsWriteThrough() {
+		cs.handleCacheOperations(address, size, true, cache.Next)
+	} else {
+		line.Dirty = true
+	}
+}
+
+// writeRequested writes the given bytes of a line the current instruction
+// has already written in the cache at the given level, without counting
+// another access. The bytes are written to the line if the cache holds it,
+// and passed on to the next level otherwise.
+func (cs *CacheSimulator) writeRequested(address uint64, size int, level int) {
+	cache := &cs.Config.Caches[level]
+	index, tag, _ := cache.GetMemoryInfo(address)
+	if hit, line := cache.CheckHitOrMiss(tag, index); hit {
+		cs.performWrite(line, address, size, level)
+	} else {
+		cs.handleCacheOperations(address, size, true, cache.Next)
+	}
+}
+
+// markRequested records that the given line has been requested from the
+// given level by the current instruction. It returns false if the line
+// had already been requested.
+func (cs *CacheSimulator) markRequested(level int, lineAddress uint64, write bool) bool {
+	req := request{address: lineAddress, write: write}
+	for _, r := range cs.requested[level] {
+		if r == req {
+			return false
+		}
+	}
+	cs.requested[level] = append(cs.requested[level], req)
+	return true
+}
+
+// writeBack writes the bytes of a dirty line back to the caches starting
+// from the given level. Each line holding the bytes is marked dirty in the
+// first write-back cache that holds it. The bytes that no cache holds are
+// written back to memory. Write-backs are not demand accesses, so they
+// don't count as hits or misses in the lower levels.
+func (cs *CacheSimulator) writeBack(address uint64, size int, level int) {
+	if level == len(cs.Config.Caches) {
+		cs.Config.MemoryWritebacks++
+		cs.Config.MemoryWriteBytes += size
+		return
+	}
+
+	cache := &cs.Config.Caches[level]
+	for size > 0 {
+		lineAddress := cache.GetLineAddress(address)
+		chunk := cache.LineSize - int(address-lineAddress)
+		if chunk > size {
+			chunk = size
+		}
+
+		// A write-back cache holding the line, in itself or in its victim
+		// cache, keeps the data and marks the line as dirty
+		held := false
+		if !cache.IsWriteThrough() {
+			index, tag, _ := cache.GetMemoryInfo(address)
+			hit, line := cache.CheckHitOrMiss(tag, index)
+			if hit {
+				line.Dirty = true
+			} else if cache.Victim != nil {
+				hit = cache.MarkVictimDirty(lineAddress)
+			}
+			held = hit
+		}
+		if !held {
+			cs.writeBack(address, chunk, cache.Next)
+		}
+
+		address = (address + uint64(chunk)) & cs.addressMask
+		size -= chunk
+	}
 }
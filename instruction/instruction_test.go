@@ -0,0 +1,126 @@
+package instruction
+
+// This file contains benchmarks for the per-access work of the cache
+// simulator. The binary string benchmarks reproduce the previous address
+// plumbing, where each access went through several string conversions,
+// so that its throughput can be compared with the uint64 path.
+// Run them with `go test -bench . ./instruction`.
+
+import (
+	"math"
+	"testing"
+
+	"github.com/nsengupta5/Cache-Simulator/cache"
+	"github.com/nsengupta5/Cache-Simulator/utils"
+)
+
+// Trace fields (address and size) taken from the sample traces
+var benchTrace = []struct {
+	address string
+	size    int
+}{
+	{"7ffd0e62", 8}, {"14000440", 2}, {"7ffd00e8", 16},
+	{"20abcdef", 64}, {"400068", 4}, {"7fff5fbff8a0", 32},
+}
+
+// newBenchConfig returns the initialized three level hierarchy of
+// sample-inputs/l1l2l3.json
+func newBenchConfig() *cache.CacheConfig {
+	config := &cache.CacheConfig{
+		Caches: []cache.Cache{
+			{Name: "L1", Size: 32768, LineSize: 32, Kind: "direct"},
+			{Name: "L2", Size: 131072, LineSize: 64, Kind: "2way", PolicyName: "lfu"},
+			{Name: "L3", Size: 16777216, LineSize: 64, Kind: "8way", PolicyName: "lru"},
+		},
+	}
+	if errs := cache.InitializeCaches(config); len(errs) > 0 {
+		panic(cache.ConfigErrors(errs))
+	}
+	return config
+}
+
+// binaryAffectedAddresses is the previous implementation of
+// getAffectedAddresses working on binary strings
+func binaryAffectedAddresses(size int, lineSize int, offset int, memAddress string) []string {
+	memAddressInt := utils.ConvertBinaryToInt(memAddress)
+	addresses := []string{memAddress}
+
+	initialBytes := lineSize - offset
+	if size <= initialBytes {
+		return addresses
+	}
+
+	remainingBytes := size - initialBytes
+	remainingAddresses := int(math.Ceil(float64(remainingBytes) / float64(lineSize)))
+	for i := 1; i <= remainingAddresses; i++ {
+		address := memAddressInt + (i * lineSize)
+		addresses = append(addresses, utils.ConvertIntToBinary(address))
+	}
+
+	return addresses
+}
+
+var sinkIndex, sinkTag int
+var sinkIndex64, sinkTag64 uint64
+
+// BenchmarkBinaryStringPath measures decoding a trace access into the
+// tag and index of every cache level through binary strings
+func BenchmarkBinaryStringPath(b *testing.B) {
+	config := newBenchConfig()
+	l1 := config.Caches[0]
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		access := benchTrace[i%len(benchTrace)]
+		memAddress := utils.ConvertHexToBinary(access.address)
+		offset := utils.GetOffset(l1.TagSize, l1.IndexSize, memAddress)
+		addresses := binaryAffectedAddresses(access.size, l1.LineSize, offset, memAddress)
+		for _, address := range addresses {
+			for _, c := range config.Caches {
+				sinkIndex, sinkTag, _ = utils.GetMemoryInfo(c.TagSize, c.IndexSize, address)
+			}
+		}
+	}
+}
+
+// BenchmarkUint64Path measures decoding a trace access into the tag and
+// index of every line it touches in every cache level through uint64 bit
+// arithmetic, with each level using its own line size
+func BenchmarkUint64Path(b *testing.B) {
+	config := newBenchConfig()
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		access := benchTrace[i%len(benchTrace)]
+		memAddress := utils.ParseHexAddress(access.address)
+		for j := range config.Caches {
+			c := &config.Caches[j]
+			end := memAddress + uint64(access.size)
+			for address := c.GetLineAddress(memAddress); address < end; address += uint64(c.LineSize) {
+				sinkIndex64, sinkTag64, _ = c.GetMemoryInfo(address)
+			}
+		}
+	}
+}
+
+// BenchmarkExecuteInstruction measures the throughput of the simulator
+// itself, from the decoded instruction to the updated cache statistics
+func BenchmarkExecuteInstruction(b *testing.B) {
+	config := newBenchConfig()
+	simulator := NewCacheSimulator(config)
+
+	instructions := make([]CacheInstruction, len(benchTrace))
+	for i, access := range benchTrace {
+		instructions[i] = CacheInstruction{
+			Address:   utils.ParseHexAddress(access.address),
+			Size:      access.size,
+			Operation: Read,
+		}
+	}
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		simulator.executeInstruction(instructions[i%len(instructions)])
+	}
+	b.ReportMetric(float64(b.N)/b.Elapsed().Seconds(), "instructions/s")
+}
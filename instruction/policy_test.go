@@ -0,0 +1,495 @@
+package instruction
+
+// This file contains the tests of the replacement policies, run on fully
+// associative caches with hand-checked traces
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/nsengupta5/Cache-Simulator/cache"
+)
+
+// readLines returns the trace lines reading a byte at each of the given
+// addresses
+func readLines(addresses ...string) []string {
+	lines := make([]string, len(addresses))
+	for i, address := range addresses {
+		lines[i] = "0 " + address + " R 1"
+	}
+	return lines
+}
+
+// runPolicy runs the given trace on a fully associative cache of the given
+// number of 64 byte lines using the given policy, and returns its hits
+func runPolicy(t *testing.T, lines int, policy string, params cache.PolicyParams, trace []string) int {
+	t.Helper()
+	config := &cache.CacheConfig{
+		Caches: []cache.Cache{{
+			Name:         "L1",
+			Size:         lines * 64,
+			LineSize:     64,
+			Kind:         "full",
+			PolicyName:   policy,
+			PolicyParams: params,
+		}},
+	}
+	runTrace(t, config, trace...)
+	return config.Caches[0].Hits
+}
+
+// The reference string of Bélády's anomaly, as line addresses
+var beladyTrace = readLines("40", "80", "c0", "100", "40", "80", "140", "40", "80", "c0", "100", "140")
+
+func TestOPT(t *testing.T) {
+	// The textbook fault counts of the reference string are 7 with OPT,
+	// 10 with LRU and 9 with FIFO for 3 frames, and 6, 8 and 10 for 4
+	// frames, FIFO faulting more with more frames
+	tests := []struct {
+		lines  int
+		policy string
+		hits   int
+	}{
+		{lines: 3, policy: "opt", hits: 5},
+		{lines: 3, policy: "lru", hits: 2},
+		{lines: 3, policy: "fifo", hits: 3},
+		{lines: 4, policy: "opt", hits: 6},
+		{lines: 4, policy: "lru", hits: 4},
+		{lines: 4, policy: "fifo", hits: 2},
+	}
+
+	for _, test := range tests {
+		if hits := runPolicy(t, test.lines, test.policy, nil, beladyTrace); hits != test.hits {
+			t.Errorf("%s with %d lines: got %d hits, want %d", test.policy, test.lines, hits, test.hits)
+		}
+	}
+}
+
+func TestOPTLevels(t *testing.T) {
+	// The next uses of every level come from the whole trace. The L1
+	// evicts A rather than C for B, and the L2 only sees its misses, A C B
+	// A, but also evicts A, as C is used again first in the trace, even
+	// though the L1 serves that access.
+	config := &cache.CacheConfig{
+		Caches: []cache.Cache{
+			{Name: "L1", Size: 128, LineSize: 64, Kind: "full", PolicyName: "opt"},
+			{Name: "L2", Size: 128, LineSize: 64, Kind: "full", PolicyName: "opt"},
+		},
+	}
+	runTrace(t, config, readLines(lineA, lineA, lineC, lineB, lineC, lineA)...)
+
+	want := []hitsMisses{{hits: 2, misses: 4}, {hits: 0, misses: 4}}
+	for i, c := range config.Caches {
+		if got := (hitsMisses{c.Hits, c.Misses}); got != want[i] {
+			t.Errorf("%s: got %+v, want %+v", c.Name, got, want[i])
+		}
+	}
+}
+
+// A cyclic trace over three lines, which thrashes a 2-line cache inserting
+// every line with the same priority
+var cyclicTrace = readLines(lineA, lineB, lineC, lineA, lineB, lineC, lineA, lineB, lineC)
+
+// A working set of two lines reused around a scan of four lines
+var scanTrace = readLines("0", "40", "0", "40", "80", "c0", "100", "140", "0", "40")
+
+func TestInsertionPolicies(t *testing.T) {
+	tests := []struct {
+		name   string
+		policy string
+		params cache.PolicyParams
+		lines  int
+		trace  []string
+		hits   int
+	}{
+		// Without a hit, SRRIP inserts every line with the same RRPV and
+		// evicts the oldest one, like LRU
+		{name: "lru cyclic", policy: "lru", lines: 2, trace: cyclicTrace, hits: 0},
+		{name: "srrip cyclic", policy: "srrip", lines: 2, trace: cyclicTrace, hits: 0},
+		// BRRIP inserts every line with the distant RRPV when epsilon is 0,
+		// so B, which hits once in the cache, keeps the RRPV of 0 and is
+		// never evicted
+		{name: "brrip cyclic", policy: "brrip", params: cache.PolicyParams{"epsilon": 0.0}, lines: 2, trace: cyclicTrace, hits: 2},
+		// With epsilon 1, BRRIP always inserts like SRRIP
+		{name: "brrip epsilon 1 cyclic", policy: "brrip", params: cache.PolicyParams{"epsilon": 1.0}, lines: 2, trace: cyclicTrace, hits: 0},
+		// The scan evicts the working set from LRU, while SRRIP evicts the
+		// scanned lines, inserted with a longer RRPV than the reused ones
+		{name: "lru scan", policy: "lru", lines: 4, trace: scanTrace, hits: 2},
+		{name: "srrip scan", policy: "srrip", lines: 4, trace: scanTrace, hits: 4},
+		// LIP inserts every line at the LRU position, so A, which hits
+		// once in the cache, moves to the MRU position and stays there
+		{name: "lip cyclic", policy: "lip", lines: 2, trace: cyclicTrace, hits: 2},
+		{name: "lip scan", policy: "lip", lines: 4, trace: scanTrace, hits: 4},
+		// BIP inserts like LIP with epsilon 0 and like LRU with epsilon 1
+		{name: "bip cyclic", policy: "bip", params: cache.PolicyParams{"epsilon": 0.0}, lines: 2, trace: cyclicTrace, hits: 2},
+		{name: "bip epsilon 1 cyclic", policy: "bip", params: cache.PolicyParams{"epsilon": 1.0}, lines: 2, trace: cyclicTrace, hits: 0},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if hits := runPolicy(t, test.lines, test.policy, test.params, test.trace); hits != test.hits {
+				t.Errorf("got %d hits, want %d", hits, test.hits)
+			}
+		})
+	}
+}
+
+func TestSetDueling(t *testing.T) {
+	// With 4 sets and a single leader set per policy, set 0 leads the
+	// first policy, set 2 the second and sets 1 and 3 follow. PSEL starts
+	// at 2 out of 3, so the followers start with the second policy, a
+	// bimodal insertion with epsilon 0, and keep a line of the cyclic
+	// trace. Two misses in set 2 bring PSEL down to 0, after which they
+	// use the first policy and thrash.
+	follower := readLines("40", "140", "240", "40", "140", "240", "40", "140", "240")
+	leaderMisses := readLines("80", "180")
+
+	tests := []struct {
+		policy string
+		trace  []string
+		hits   int
+	}{
+		{policy: "drrip", trace: follower, hits: 2},
+		{policy: "drrip", trace: append(leaderMisses, follower...), hits: 0},
+		{policy: "dip", trace: follower, hits: 2},
+		{policy: "dip", trace: append(leaderMisses, follower...), hits: 0},
+	}
+
+	for _, test := range tests {
+		config := &cache.CacheConfig{
+			Caches: []cache.Cache{{
+				Name:       "L1",
+				Size:       512,
+				LineSize:   64,
+				Kind:       "2way",
+				PolicyName: test.policy,
+				// The parameters are decoded from JSON as float64
+				PolicyParams: cache.PolicyParams{
+					"leader_sets": 1.0,
+					"psel_bits":   2.0,
+					"epsilon":     0.0,
+				},
+			}},
+		}
+		runTrace(t, config, test.trace...)
+		if hits := config.Caches[0].Hits; hits != test.hits {
+			t.Errorf("%s with %d accesses: got %d hits, want %d", test.policy, len(test.trace), hits, test.hits)
+		}
+	}
+}
+
+// pcTrace returns a trace of the given number of rounds, each reading a
+// working set of two lines with one PC and then four lines of a stream
+// with another. The stream first reads the given number of lines on its
+// own.
+func pcTrace(warmup int, rounds int) []string {
+	trace := []string{}
+	stream := 0
+	readStream := func(lines int) {
+		for i := 0; i < lines; i++ {
+			trace = append(trace, fmt.Sprintf("800 %x R 1", 0x10000+stream*0x40))
+			stream++
+		}
+	}
+	readStream(warmup)
+	for round := 0; round < rounds; round++ {
+		trace = append(trace, "400 0 R 1", "400 40 R 1")
+		readStream(4)
+	}
+	return trace
+}
+
+func TestPCPolicies(t *testing.T) {
+	// In a 4-line cache, the stream evicts the working set between its
+	// uses from LRU and SRRIP, while OPT keeps it and hits twice in every
+	// round but the first. When the stream fills the cache first, its
+	// lines are evicted unused before the working set is, so both PC
+	// policies learn to evict them first and match OPT. Otherwise, the
+	// working set is evicted unused first: the SHiP counter of its PC
+	// drops to zero and it is never kept, and Hawkeye, still training
+	// its predictor, misses it in two more rounds than OPT.
+	tests := []struct {
+		warmup int
+		hits   map[string]int
+	}{
+		{warmup: 4, hits: map[string]int{"opt": 18, "lru": 0, "srrip": 0, "ship": 18, "hawkeye": 18}},
+		{warmup: 0, hits: map[string]int{"opt": 18, "lru": 0, "srrip": 0, "ship": 0, "hawkeye": 14}},
+	}
+
+	for _, test := range tests {
+		trace := pcTrace(test.warmup, 10)
+		for policy, want := range test.hits {
+			if hits := runPolicy(t, 4, policy, nil, trace); hits != want {
+				t.Errorf("%s with a warm-up of %d lines: got %d hits, want %d", policy, test.warmup, hits, want)
+			}
+		}
+	}
+}
+
+func TestLFU(t *testing.T) {
+	tests := []struct {
+		name   string
+		params cache.PolicyParams
+		lines  int
+		trace  []string
+		hits   int
+	}{
+		// A is referenced three times, so C evicts B and A hits again
+		{name: "no aging", lines: 2, trace: readLines(lineA, lineA, lineA, lineB, lineC, lineA), hits: 3},
+		// The insertion of B is the fourth access to the set, which halves
+		// the count of A to 1, the count of B. A, referenced the longest
+		// time ago, is evicted for C.
+		{
+			name:   "halving",
+			params: cache.PolicyParams{"aging": cache.HalvingAging, "aging_interval": 4.0},
+			lines:  2,
+			trace:  readLines(lineA, lineA, lineA, lineB, lineC, lineA),
+			hits:   2,
+		},
+		// B evicts A and sets the age to 1, after which the hits on B and
+		// C give both a priority of 1 plus their count of 2. D evicts B,
+		// referenced the longest time ago, and C hits again. Adding one to
+		// the priority of C, inserted before the age grew, would have
+		// evicted it instead.
+		{
+			name:   "dynamic aging",
+			params: cache.PolicyParams{"aging": cache.DynamicAging},
+			lines:  2,
+			trace:  readLines("0", "80", "40", "40", "80", "c0", "80"),
+			hits:   3,
+		},
+		// With 1-bit counters, every count saturates at 1 and the ties
+		// between A and B evict the least recently used line, B, or the
+		// line filled first, A
+		{
+			name:   "saturated lru tie-break",
+			params: cache.PolicyParams{"counter_bits": 1.0, "tie_break": cache.LRUTieBreak},
+			lines:  2,
+			trace:  readLines(lineA, lineB, lineA, lineC, lineA),
+			hits:   2,
+		},
+		{
+			name:   "saturated fifo tie-break",
+			params: cache.PolicyParams{"counter_bits": 1.0, "tie_break": cache.FIFOTieBreak},
+			lines:  2,
+			trace:  readLines(lineA, lineB, lineA, lineC, lineA),
+			hits:   1,
+		},
+		{
+			name:   "fifo tie-break",
+			params: cache.PolicyParams{"tie_break": cache.FIFOTieBreak},
+			lines:  2,
+			trace:  readLines(lineA, lineB, lineA, lineC, lineA),
+			hits:   2,
+		},
+		// The counts saturate, but the age doesn't: C evicts B, filled
+		// first, and sets the age to 1, so the hit on D gives it a
+		// priority of 2, above A, which B then evicts
+		{
+			name:   "saturated dynamic aging",
+			params: cache.PolicyParams{"aging": cache.DynamicAging, "counter_bits": 1.0, "tie_break": cache.FIFOTieBreak},
+			lines:  3,
+			trace:  readLines("40", "c0", "0", "80", "c0", "40", "c0"),
+			hits:   2,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if hits := runPolicy(t, test.lines, "lfu", test.params, test.trace); hits != test.hits {
+				t.Errorf("got %d hits, want %d", hits, test.hits)
+			}
+		})
+	}
+}
+
+func TestGhostLists(t *testing.T) {
+	tests := []struct {
+		name   string
+		policy string
+		lines  int
+		trace  []string
+		hits   int
+		ghosts map[string]uint64 // The ghost hits reported by the policy
+	}{
+		{
+			// C evicts B from T1 into B1, since p is 0. The miss on B in
+			// B1 grows p to 1, so B evicts A from T2 and D evicts B from
+			// T2 rather than C from T1, which hits. The miss on A in B2
+			// shrinks p back to 0, so A evicts D from T1, and C hits in
+			// T2 again.
+			name:   "arc",
+			policy: "arc",
+			lines:  2,
+			trace:  readLines("0", "0", "40", "80", "40", "c0", "80", "0", "80"),
+			hits:   3,
+			ghosts: map[string]uint64{"b1_hits": 1, "b2_hits": 1},
+		},
+		{
+			// A1in holds a single line out of four. E evicts A into A1out,
+			// and the miss on A there promotes it to Am, where the scan of
+			// F, G, H and I, evicted from A1in, can't reach it. LRU would
+			// evict A for I.
+			name:   "2q",
+			policy: "2q",
+			lines:  4,
+			trace:  readLines("0", "40", "80", "c0", "100", "0", "140", "180", "1c0", "200", "0"),
+			hits:   1,
+			ghosts: map[string]uint64{"ghost_hits": 1},
+		},
+		{
+			name:   "lru",
+			policy: "lru",
+			lines:  4,
+			trace:  readLines("0", "40", "80", "c0", "100", "0", "140", "180", "1c0", "200", "0"),
+			hits:   0,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			config := &cache.CacheConfig{
+				Caches: []cache.Cache{{
+					Name:       "L1",
+					Size:       test.lines * 64,
+					LineSize:   64,
+					Kind:       "full",
+					PolicyName: test.policy,
+				}},
+			}
+			runTrace(t, config, test.trace...)
+
+			c := &config.Caches[0]
+			if c.Hits != test.hits {
+				t.Errorf("got %d hits, want %d", c.Hits, test.hits)
+			}
+			for name, want := range test.ghosts {
+				if got := c.PolicyState.Stats()[name]; got != want {
+					t.Errorf("%s: got %v, want %d", name, got, want)
+				}
+			}
+		})
+	}
+}
+
+func TestFIFOInvalidation(t *testing.T) {
+	// Core 0 fills A and B, and the write of core 1 invalidates A, freeing
+	// its way, which C fills. D evicts B, the oldest fill, with FIFO, but
+	// C with RR, whose pointer is still on the first way, so C only hits
+	// with FIFO. The timestamps keep the accesses in the order of the
+	// trace.
+	trace := []string{
+		"0 " + lineA + " R 1 0 1",
+		"0 " + lineB + " R 1 0 2",
+		"0 " + lineA + " W 1 1 3",
+		"0 " + lineC + " R 1 0 4",
+		"0 c0 R 1 0 5",
+		"0 " + lineC + " R 1 0 6",
+	}
+
+	tests := []struct {
+		policy string
+		l1     hitsMisses
+	}{
+		{policy: "fifo", l1: hitsMisses{hits: 1, misses: 4}},
+		{policy: "rr", l1: hitsMisses{hits: 0, misses: 5}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.policy, func(t *testing.T) {
+			config := newMultiCoreConfig()
+			config.Coherence = "mesi"
+			config.Interleave = cache.Timestamp
+			config.Caches[0].PolicyName = test.policy
+			runTrace(t, config, trace...)
+
+			l1 := cacheNamed(t, config, cache.CoreCacheName("L1", 0))
+			if got := (hitsMisses{l1.Hits, l1.Misses}); got != test.l1 {
+				t.Errorf("got %+v, want %+v", got, test.l1)
+			}
+		})
+	}
+}
+
+func TestReferenceBits(t *testing.T) {
+	// A, B and C fill the three ways with their bits set. D clears every
+	// bit, evicting A from the first way. The hit on B sets its bit again,
+	// so E evicts C, and the hits on B keep it in the cache until the end.
+	trace := readLines("0", "40", "80", "c0", "40", "100", "40", "80", "40")
+
+	tests := []struct {
+		policy string
+		stats  map[string]uint64 // The counters reported by the policy
+	}{
+		{
+			// The hand sweeps the three ways for D, stopping on A. For E
+			// it gives B a second chance and wraps around after C. For C
+			// it gives D, B and E a second chance, and evicts D.
+			policy: "clock",
+			stats:  map[string]uint64{"hand_advances": 10, "second_chances": 7, "hand_sweeps": 3},
+		},
+		{
+			// The bits are reset for D, evicting A, and again for C, as B
+			// and E set the bits of the two other ways, evicting D
+			policy: "nru",
+			stats:  map[string]uint64{"resets": 2},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.policy, func(t *testing.T) {
+			config := &cache.CacheConfig{
+				Caches: []cache.Cache{{
+					Name:       "L1",
+					Size:       3 * 64,
+					LineSize:   64,
+					Kind:       "full",
+					PolicyName: test.policy,
+				}},
+			}
+			runTrace(t, config, trace...)
+
+			c := &config.Caches[0]
+			if c.Hits != 3 {
+				t.Errorf("got %d hits, want 3", c.Hits)
+			}
+			for name, want := range test.stats {
+				if got := c.PolicyState.Stats()[name]; got != want {
+					t.Errorf("%s: got %v, want %d", name, got, want)
+				}
+			}
+		})
+	}
+}
+
+// The trace telling LRU and the PLRU policies apart on 4 lines. A, B, C
+// and D fill the ways in order, and A hits.
+var plruTrace = readLines("0", "40", "80", "c0", "0", "100", "40", "80", "0")
+
+func TestPLRU(t *testing.T) {
+	tests := []struct {
+		policy string
+		hits   int
+	}{
+		// E evicts B, B evicts C and C evicts D, so only the two accesses
+		// to A hit
+		{policy: "lru", hits: 2},
+		// The hit on A points the root to the right half and leaves the
+		// bit of that half pointing at C, which E evicts. The hit on B
+		// points the root back to the right, where the bit now points
+		// at D, which C evicts, and A hits again.
+		{policy: "plru_tree", hits: 3},
+		// D clears the bits of A, B and C, so that E evicts B, the first
+		// way left clear after the hit on A. B evicts C and clears the
+		// other bits, so that C evicts A and A evicts E.
+		{policy: "plru_bit", hits: 1},
+	}
+
+	for _, test := range tests {
+		t.Run(test.policy, func(t *testing.T) {
+			if hits := runPolicy(t, 4, test.policy, nil, plruTrace); hits != test.hits {
+				t.Errorf("got %d hits, want %d", hits, test.hits)
+			}
+		})
+	}
+}
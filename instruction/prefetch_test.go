@@ -0,0 +1,123 @@
+package instruction
+
+// This file contains the tests of the prefetchers, run on a single cache
+// with hand-checked traces
+
+import (
+	"testing"
+
+	"github.com/nsengupta5/Cache-Simulator/cache"
+)
+
+// The expected prefetch activity of a cache
+type prefetchCounts struct {
+	issued, useful, late, useless, pollution int
+}
+
+func TestPrefetchers(t *testing.T) {
+	// The accesses of a single instruction moving 4 lines at a time
+	strideTrace := []string{"4 0 R 1", "4 100 R 1", "4 200 R 1", "4 300 R 1", "4 400 R 1"}
+
+	tests := []struct {
+		name       string
+		lines      int
+		prefetcher cache.PrefetcherConfig
+		trace      []string
+		hits       int
+		counts     prefetchCounts
+	}{
+		{
+			// The miss on A prefetches B, which hits. E evicts A and the
+			// prefetch of F evicts B, which is no longer a prefetched
+			// line. I evicts E and the prefetch of J evicts F before it
+			// is used.
+			name:       "next line",
+			lines:      2,
+			prefetcher: cache.PrefetcherConfig{Kind: cache.NextLinePrefetcher},
+			trace:      readLines("0", "40", "100", "200"),
+			hits:       1,
+			counts:     prefetchCounts{issued: 3, useful: 1, useless: 1, pollution: 1},
+		},
+		{
+			// The prefetch of B completes at the access to B
+			name:       "next line latency",
+			lines:      2,
+			prefetcher: cache.PrefetcherConfig{Kind: cache.NextLinePrefetcher, Latency: 1},
+			trace:      readLines("0", "40"),
+			hits:       1,
+			counts:     prefetchCounts{issued: 1, useful: 1},
+		},
+		{
+			// The prefetch of B completes an access after the access to B
+			name:       "late next line",
+			lines:      2,
+			prefetcher: cache.PrefetcherConfig{Kind: cache.NextLinePrefetcher, Latency: 2},
+			trace:      readLines("0", "40"),
+			hits:       1,
+			counts:     prefetchCounts{issued: 1, useful: 1, late: 1},
+		},
+		{
+			// The misses on lines 0 and 4 train the stride, which is
+			// confirmed by the miss on line 8. The miss on line 12
+			// prefetches line 16, which hits and prefetches line 20.
+			name:       "stride",
+			lines:      8,
+			prefetcher: cache.PrefetcherConfig{Kind: cache.StridePrefetcher},
+			trace:      strideTrace,
+			hits:       1,
+			counts:     prefetchCounts{issued: 2, useful: 1},
+		},
+		{
+			// The miss on line 12 prefetches lines 16 and 20, and the hit
+			// on line 16 lines 20 and 24, of which only line 24 is new
+			name:       "stride degree",
+			lines:      8,
+			prefetcher: cache.PrefetcherConfig{Kind: cache.StridePrefetcher, Degree: 2},
+			trace:      strideTrace,
+			hits:       1,
+			counts:     prefetchCounts{issued: 3, useful: 1},
+		},
+		{
+			// Every instruction replaces the entry of the other one in a
+			// single entry table, so no stride is ever confirmed
+			name:       "stride table conflict",
+			lines:      8,
+			prefetcher: cache.PrefetcherConfig{Kind: cache.StridePrefetcher, TableSize: 1},
+			trace:      []string{"4 0 R 1", "8 1000 R 1", "4 100 R 1", "8 1100 R 1", "4 200 R 1", "8 1200 R 1", "4 300 R 1", "8 1300 R 1"},
+			counts:     prefetchCounts{},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			prefetcher := test.prefetcher
+			config := &cache.CacheConfig{
+				Caches: []cache.Cache{{
+					Name:             "L1",
+					Size:             test.lines * 64,
+					LineSize:         64,
+					Kind:             "full",
+					PolicyName:       "lru",
+					PrefetcherConfig: &prefetcher,
+				}},
+			}
+			runTrace(t, config, test.trace...)
+
+			c := &config.Caches[0]
+			if c.Hits != test.hits || c.Misses != len(test.trace)-test.hits {
+				t.Errorf("got %d hits and %d misses, want %d and %d",
+					c.Hits, c.Misses, test.hits, len(test.trace)-test.hits)
+			}
+			got := prefetchCounts{
+				issued:    c.PrefetchesIssued,
+				useful:    c.UsefulPrefetches,
+				late:      c.LatePrefetches,
+				useless:   c.UselessPrefetches,
+				pollution: c.PollutionEvictions,
+			}
+			if got != test.counts {
+				t.Errorf("got %+v, want %+v", got, test.counts)
+			}
+		})
+	}
+}
@@ -0,0 +1,297 @@
+package instruction
+
+// This file contains the tests of the trace reading of the simulator, and
+// the helpers running small hand-written traces used by the other tests.
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/nsengupta5/Cache-Simulator/cache"
+)
+
+// writeTrace writes the given lines to a trace file in a temporary
+// directory and returns its path
+func writeTrace(t *testing.T, lines ...string) string {
+	t.Helper()
+	file, err := os.CreateTemp(t.TempDir(), "trace")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+	if _, err := file.WriteString(strings.Join(lines, "\n") + "\n"); err != nil {
+		t.Fatal(err)
+	}
+	return file.Name()
+}
+
+// runTrace initializes the given configuration and runs the given trace
+// lines with it, as a single trace file
+func runTrace(t *testing.T, config *cache.CacheConfig, lines ...string) {
+	t.Helper()
+	if errs := cache.InitializeCaches(config); len(errs) > 0 {
+		t.Fatal(cache.ConfigErrors(errs))
+	}
+	if err := NewCacheSimulator(config).Run(writeTrace(t, lines...)); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// cacheNamed returns the cache of an initialized configuration with the
+// given name
+func cacheNamed(t *testing.T, config *cache.CacheConfig, name string) *cache.Cache {
+	t.Helper()
+	for i := range config.Caches {
+		if config.Caches[i].Name == name {
+			return &config.Caches[i]
+		}
+	}
+	t.Fatalf("no cache named %q", name)
+	return nil
+}
+
+// newMultiCoreConfig returns a hierarchy of two cores, each with a private
+// 2-line L1, sharing an 8-line L2
+func newMultiCoreConfig() *cache.CacheConfig {
+	return &cache.CacheConfig{
+		Cores: 2,
+		Caches: []cache.Cache{
+			{Name: "L1", Size: 128, LineSize: 64, Kind: "full", PolicyName: "lru", Private: true},
+			{Name: "L2", Size: 512, LineSize: 64, Kind: "full", PolicyName: "lru"},
+		},
+	}
+}
+
+func TestSharedTraceCores(t *testing.T) {
+	tests := []struct {
+		name   string
+		lines  []string
+		counts []cache.CoreStats
+	}{
+		{
+			// The lines without a core belong to core 0, and are only
+			// executed once
+			name:  "legacy lines",
+			lines: []string{"0 0 R 4", "0 40 W 4", "0 80 R 4"},
+			counts: []cache.CoreStats{
+				{Instructions: 3, Reads: 2, Writes: 1, MemoryAccesses: 3},
+				{},
+			},
+		},
+		{
+			name:  "core fields",
+			lines: []string{"0 0 R 4 1", "0 40 W 4 0", "0 80 R 4 1", "0 0 R 4 0"},
+			counts: []cache.CoreStats{
+				{Instructions: 2, Reads: 1, Writes: 1, MemoryAccesses: 1},
+				{Instructions: 2, Reads: 2, MemoryAccesses: 2},
+			},
+		},
+		{
+			name:  "mixed lines",
+			lines: []string{"0 0 R 4", "0 0 R 4 1", "0 40 R 4 1"},
+			counts: []cache.CoreStats{
+				{Instructions: 1, Reads: 1, MemoryAccesses: 1},
+				{Instructions: 2, Reads: 2, MemoryAccesses: 1},
+			},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			config := newMultiCoreConfig()
+			runTrace(t, config, test.lines...)
+			for core, want := range test.counts {
+				if got := config.CoreStats[core]; got != want {
+					t.Errorf("core %d: got %+v, want %+v", core, got, want)
+				}
+			}
+		})
+	}
+}
+
+func TestSharedTraceReadAhead(t *testing.T) {
+	// The only access of core 1 comes after more lines of core 0 than the
+	// readers buffer, but runs first with its earlier timestamp, so that
+	// core 0 finds A in the L2
+	lines := []string{}
+	for i := 1; i <= 3*bufferSize; i++ {
+		lines = append(lines, fmt.Sprintf("0 %s R 4 0 %d", lineA, i))
+	}
+	lines = append(lines, "0 "+lineA+" R 4 1 0")
+
+	config := newMultiCoreConfig()
+	config.Interleave = cache.Timestamp
+	runTrace(t, config, lines...)
+	counts := []cache.CoreStats{
+		{Instructions: 3 * bufferSize, Reads: 3 * bufferSize},
+		{Instructions: 1, Reads: 1, MemoryAccesses: 1},
+	}
+	for core, want := range counts {
+		if got := config.CoreStats[core]; got != want {
+			t.Errorf("core %d: got %+v, want %+v", core, got, want)
+		}
+	}
+}
+
+func TestTraceFilesPerCore(t *testing.T) {
+	shared := newMultiCoreConfig()
+	runTrace(t, shared, "0 0 R 4 0", "0 0 R 4 1", "0 40 W 4 0", "0 80 R 4 1", "0 c0 R 4 0")
+
+	perCore := newMultiCoreConfig()
+	if errs := cache.InitializeCaches(perCore); len(errs) > 0 {
+		t.Fatal(cache.ConfigErrors(errs))
+	}
+	err := NewCacheSimulator(perCore).Run(
+		writeTrace(t, "0 0 R 4", "0 40 W 4", "0 c0 R 4"),
+		writeTrace(t, "0 0 R 4", "0 80 R 4"),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for core := range shared.CoreStats {
+		if shared.CoreStats[core] != perCore.CoreStats[core] {
+			t.Errorf("core %d: shared trace %+v, trace per core %+v",
+				core, shared.CoreStats[core], perCore.CoreStats[core])
+		}
+	}
+	for i := range shared.Caches {
+		s, p := shared.Caches[i], perCore.Caches[i]
+		if s.Hits != p.Hits || s.Misses != p.Misses {
+			t.Errorf("%s: shared trace %d hits %d misses, trace per core %d hits %d misses",
+				s.Name, s.Hits, s.Misses, p.Hits, p.Misses)
+		}
+	}
+}
+
+func TestTraceErrors(t *testing.T) {
+	tests := []struct {
+		name   string
+		traces [][]string
+		err    string
+	}{
+		{
+			name:   "unknown core",
+			traces: [][]string{{"0 0 R 4 0", "0 40 R 4 2"}},
+			err:    `:2: unknown core "2"`,
+		},
+		{
+			name:   "invalid core",
+			traces: [][]string{{"0 0 R 4 one"}},
+			err:    `:1: unknown core "one"`,
+		},
+		{
+			name:   "missing fields",
+			traces: [][]string{{"0 0 R 4", "0 40"}},
+			err:    ":2: expected the PC, address, operation and size",
+		},
+		{
+			name:   "invalid address",
+			traces: [][]string{{"0 zz R 4"}},
+			err:    `:1: invalid address "zz"`,
+		},
+		{
+			name:   "address wider than 64 bits",
+			traces: [][]string{{"0 1ffffffffffffffff R 4"}},
+			err:    `:1: invalid address "1ffffffffffffffff"`,
+		},
+		{
+			name:   "invalid PC",
+			traces: [][]string{{"pc 40 R 4"}},
+			err:    `:1: invalid PC "pc"`,
+		},
+		{
+			name:   "invalid size",
+			traces: [][]string{{"0 0 R 4", "0 40 R x"}},
+			err:    `:2: invalid size "x"`,
+		},
+		{
+			name:   "empty operation",
+			traces: [][]string{{"0 40  4"}},
+			err:    `:1: unknown operation ""`,
+		},
+		{
+			name:   "unknown operation",
+			traces: [][]string{{"0 0 R 4", "0 40 X 4"}},
+			err:    `:2: unknown operation "X", expected R, W or I`,
+		},
+		{
+			name:   "lowercase operation",
+			traces: [][]string{{"0 40 r 4"}},
+			err:    `:1: unknown operation "r"`,
+		},
+		{
+			name:   "invalid timestamp",
+			traces: [][]string{{"0 40 R 4 0 abc"}},
+			err:    `:1: invalid timestamp "abc"`,
+		},
+		{
+			name:   "trace file count",
+			traces: [][]string{{"0 0 R 4"}, {"0 0 R 4"}, {"0 0 R 4"}},
+			err:    "expected 1 trace file or 1 per core (2), got 3",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			config := newMultiCoreConfig()
+			if errs := cache.InitializeCaches(config); len(errs) > 0 {
+				t.Fatal(cache.ConfigErrors(errs))
+			}
+			traceFiles := []string{}
+			for _, lines := range test.traces {
+				traceFiles = append(traceFiles, writeTrace(t, lines...))
+			}
+
+			err := NewCacheSimulator(config).Run(traceFiles...)
+			if err == nil || !strings.Contains(err.Error(), test.err) {
+				t.Errorf("got error %v, want %q", err, test.err)
+			}
+		})
+	}
+}
+
+func TestMissingTraceFile(t *testing.T) {
+	config := newMultiCoreConfig()
+	if errs := cache.InitializeCaches(config); len(errs) > 0 {
+		t.Fatal(cache.ConfigErrors(errs))
+	}
+	missing := filepath.Join(t.TempDir(), "missing")
+	if err := NewCacheSimulator(config).Run(missing); !os.IsNotExist(err) {
+		t.Errorf("got error %v, want a missing file error", err)
+	}
+}
+
+func TestAddressBits(t *testing.T) {
+	tests := []struct {
+		name    string
+		address string
+		err     string
+	}{
+		{name: "within the address bits", address: "ffffffff"},
+		{name: "wider than the address bits", address: "1ffffffff", err: ":2: address 1ffffffff is wider than the 32 address bits"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			config := &cache.CacheConfig{
+				AddressBits: 32,
+				Caches:      []cache.Cache{{Name: "L1", Size: 128, LineSize: 64, Kind: "direct"}},
+			}
+			if errs := cache.InitializeCaches(config); len(errs) > 0 {
+				t.Fatal(cache.ConfigErrors(errs))
+			}
+
+			err := NewCacheSimulator(config).Run(writeTrace(t, "0 0 R 4", "0 "+test.address+" R 1"))
+			switch {
+			case test.err == "" && err != nil:
+				t.Errorf("got error %v", err)
+			case test.err != "" && (err == nil || !strings.Contains(err.Error(), test.err)):
+				t.Errorf("got error %v, want %q", err, test.err)
+			}
+		})
+	}
+}
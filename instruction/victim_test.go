@@ -0,0 +1,117 @@
+package instruction
+
+// This file contains the tests of the victim caches
+
+import (
+	"testing"
+
+	"github.com/nsengupta5/Cache-Simulator/cache"
+)
+
+func TestVictimCache(t *testing.T) {
+	// In a direct-mapped 2-line cache, A, C and E map to set 0 and B to
+	// set 1. With a single victim entry, A and C conflicting in set 0
+	// are swapped with each other from the victim cache, while a third
+	// line pushes the first one out of the victim cache to memory.
+	const lineE = "100"
+	tests := []struct {
+		name             string
+		entries          int
+		trace            []string
+		victimHits       int
+		victimSwaps      int
+		memoryAccesses   int
+		memoryWritebacks int
+	}{
+		{
+			name:           "without a victim cache",
+			trace:          readLines(lineA, lineC, lineA, lineC, lineB, lineA),
+			memoryAccesses: 6,
+		},
+		{
+			name:           "conflicting lines",
+			entries:        1,
+			trace:          readLines(lineA, lineC, lineA, lineC, lineB, lineA),
+			victimHits:     3,
+			victimSwaps:    3,
+			memoryAccesses: 3,
+		},
+		{
+			name:           "victim cache overflow",
+			entries:        1,
+			trace:          readLines(lineA, lineC, lineE, lineA, lineC, lineE),
+			memoryAccesses: 6,
+		},
+		{
+			name:           "larger victim cache",
+			entries:        2,
+			trace:          readLines(lineA, lineC, lineE, lineA, lineC, lineE),
+			victimHits:     3,
+			victimSwaps:    3,
+			memoryAccesses: 3,
+		},
+		{
+			// A leaves the victim cache dirty, and is written back
+			name:             "dirty victim",
+			entries:          1,
+			trace:            []string{"0 " + lineA + " W 1", "0 " + lineC + " R 1", "0 " + lineE + " R 1"},
+			memoryAccesses:   3,
+			memoryWritebacks: 1,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			config := &cache.CacheConfig{
+				Caches: []cache.Cache{{Name: "L1", Size: 128, LineSize: 64, Kind: "direct"}},
+			}
+			if test.entries > 0 {
+				config.Caches[0].VictimConfig = &cache.VictimCacheConfig{Entries: test.entries}
+			}
+			runTrace(t, config, test.trace...)
+
+			l1 := &config.Caches[0]
+			if l1.Hits != 0 || l1.Misses != len(test.trace) {
+				t.Errorf("L1: got %d hits %d misses, want every access to miss", l1.Hits, l1.Misses)
+			}
+			if l1.VictimHits != test.victimHits {
+				t.Errorf("victim hits: got %d, want %d", l1.VictimHits, test.victimHits)
+			}
+			if l1.VictimSwaps != test.victimSwaps {
+				t.Errorf("victim swaps: got %d, want %d", l1.VictimSwaps, test.victimSwaps)
+			}
+			if config.MemoryAccesses != test.memoryAccesses {
+				t.Errorf("memory accesses: got %d, want %d", config.MemoryAccesses, test.memoryAccesses)
+			}
+			if config.MemoryWritebacks != test.memoryWritebacks {
+				t.Errorf("memory write-backs: got %d, want %d", config.MemoryWritebacks, test.memoryWritebacks)
+			}
+		})
+	}
+}
+
+func TestExclusiveVictimHit(t *testing.T) {
+	// In an exclusive hierarchy of 1-line caches, B moves A down to the
+	// L2, and C moves B down, which pushes A into the victim cache of the
+	// L2. A then moves up from the victim cache: the L2 doesn't allocate
+	// the lines moving up, so the victim hit swaps nothing.
+	config := &cache.CacheConfig{
+		Inclusion: cache.Exclusive,
+		Caches: []cache.Cache{
+			{Name: "L1", Size: 64, LineSize: 64, Kind: "full"},
+			{Name: "L2", Size: 64, LineSize: 64, Kind: "full", VictimConfig: &cache.VictimCacheConfig{Entries: 1}},
+		},
+	}
+	runTrace(t, config, readLines(lineA, lineB, lineC, lineA)...)
+
+	l2 := &config.Caches[1]
+	if got, want := (hitsMisses{l2.Hits, l2.Misses}), (hitsMisses{hits: 1, misses: 3}); got != want {
+		t.Errorf("L2: got %+v, want %+v", got, want)
+	}
+	if l2.VictimHits != 1 || l2.VictimSwaps != 0 {
+		t.Errorf("L2: got %d victim hits and %d swaps, want 1 and 0", l2.VictimHits, l2.VictimSwaps)
+	}
+	if config.MemoryAccesses != 3 {
+		t.Errorf("memory accesses: got %d, want 3", config.MemoryAccesses)
+	}
+}
@@ -0,0 +1,129 @@
+package instruction
+
+// This file contains the tests of the write policies and of the bytes
+// written to main memory
+
+import (
+	"testing"
+
+	"github.com/nsengupta5/Cache-Simulator/cache"
+)
+
+func TestWriteThroughLineSizes(t *testing.T) {
+	// A 64-byte write spans two 32-byte lines of the L1, each forwarding
+	// its half to the same 64-byte line of the L2. The L2 counts a single
+	// write, but both halves reach memory through a write-through L2.
+	tests := []struct {
+		name             string
+		l1MissPolicy     string
+		l2Policy         string
+		memoryWrites     int
+		memoryWriteBytes int
+	}{
+		{name: "write-through L2", l2Policy: cache.WriteThrough, memoryWrites: 2, memoryWriteBytes: 64},
+		{name: "no-write-allocate L1", l1MissPolicy: cache.NoWriteAllocate, l2Policy: cache.WriteThrough, memoryWrites: 2, memoryWriteBytes: 64},
+		{name: "write-back L2", l2Policy: cache.WriteBack},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			config := &cache.CacheConfig{
+				Caches: []cache.Cache{
+					{Name: "L1", Size: 128, LineSize: 32, Kind: "full", WritePolicy: cache.WriteThrough, WriteMissPolicy: test.l1MissPolicy},
+					{Name: "L2", Size: 256, LineSize: 64, Kind: "full", WritePolicy: test.l2Policy},
+				},
+			}
+			runTrace(t, config, "0 0 W 64")
+
+			if l2 := config.Caches[1]; l2.Writes != 1 {
+				t.Errorf("L2 writes: got %d, want 1", l2.Writes)
+			}
+			if config.MemoryBytes != 64 {
+				t.Errorf("memory bytes read: got %d, want 64", config.MemoryBytes)
+			}
+			if config.MemoryWrites != test.memoryWrites {
+				t.Errorf("memory writes: got %d, want %d", config.MemoryWrites, test.memoryWrites)
+			}
+			if config.MemoryWriteBytes != test.memoryWriteBytes {
+				t.Errorf("memory write bytes: got %d, want %d", config.MemoryWriteBytes, test.memoryWriteBytes)
+			}
+		})
+	}
+}
+
+// The expected activity of a cache and of main memory
+type writeCounts struct {
+	hits, dirtyEvictions                             int
+	memoryAccesses, memoryBytes                      int
+	memoryWrites, memoryWritebacks, memoryWriteBytes int
+}
+
+func TestWritePolicies(t *testing.T) {
+	// A single-line cache reads A, writes 4 bytes of A, which hits, and 4
+	// bytes of B, which misses, then reads A and B again
+	trace := []string{"0 0 R 4", "0 0 W 4", "0 40 W 4", "0 0 R 4", "0 40 R 4"}
+
+	tests := []struct {
+		writePolicy, writeMissPolicy string
+		counts                       writeCounts
+	}{
+		{
+			// B is fetched for the write and evicts A, and A evicts B, both
+			// dirty and written back
+			writePolicy: cache.WriteBack, writeMissPolicy: cache.WriteAllocate,
+			counts: writeCounts{hits: 1, dirtyEvictions: 2, memoryAccesses: 4, memoryBytes: 256,
+				memoryWritebacks: 2, memoryWriteBytes: 128},
+		},
+		{
+			// Both writes go through to memory, and no line is dirty
+			writePolicy: cache.WriteThrough, writeMissPolicy: cache.WriteAllocate,
+			counts: writeCounts{hits: 1, memoryAccesses: 4, memoryBytes: 256,
+				memoryWrites: 2, memoryWriteBytes: 8},
+		},
+		{
+			// The write to B goes to memory without evicting A, which hits
+			// and is written back when B is read
+			writePolicy: cache.WriteBack, writeMissPolicy: cache.NoWriteAllocate,
+			counts: writeCounts{hits: 2, dirtyEvictions: 1, memoryAccesses: 2, memoryBytes: 128,
+				memoryWrites: 1, memoryWritebacks: 1, memoryWriteBytes: 68},
+		},
+		{
+			writePolicy: cache.WriteThrough, writeMissPolicy: cache.NoWriteAllocate,
+			counts: writeCounts{hits: 2, memoryAccesses: 2, memoryBytes: 128,
+				memoryWrites: 2, memoryWriteBytes: 8},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.writePolicy+" "+test.writeMissPolicy, func(t *testing.T) {
+			config := &cache.CacheConfig{
+				Caches: []cache.Cache{{
+					Name:            "L1",
+					Size:            64,
+					LineSize:        64,
+					Kind:            "direct",
+					WritePolicy:     test.writePolicy,
+					WriteMissPolicy: test.writeMissPolicy,
+				}},
+			}
+			runTrace(t, config, trace...)
+
+			l1 := config.Caches[0]
+			if l1.Misses != len(trace)-l1.Hits {
+				t.Errorf("got %d hits and %d misses for %d accesses", l1.Hits, l1.Misses, len(trace))
+			}
+			got := writeCounts{
+				hits:             l1.Hits,
+				dirtyEvictions:   l1.DirtyEvictions,
+				memoryAccesses:   config.MemoryAccesses,
+				memoryBytes:      config.MemoryBytes,
+				memoryWrites:     config.MemoryWrites,
+				memoryWritebacks: config.MemoryWritebacks,
+				memoryWriteBytes: config.MemoryWriteBytes,
+			}
+			if got != test.counts {
+				t.Errorf("got %+v, want %+v", got, test.counts)
+			}
+		})
+	}
+}
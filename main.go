@@ -5,6 +5,8 @@ package main
 // and the cache simulator.
 
 import (
+	"flag"
+	"fmt"
 	"os"
 
 	"github.com/nsengupta5/Cache-Simulator/cache"
@@ -13,14 +15,79 @@ import (
 
 func main() {
 	// Read in the command line arguements
-	configFile := os.Args[1]
-	traceFile := os.Args[2]
+	checkConfig := flag.Bool("check-config", false, "only validate the config file")
+	comparePLRU := flag.Bool("compare-plru", false, "compare the hit rates of the PLRU policies with LRU")
+	seeds := flag.Int("seeds", 0, "run the trace with `N` seeds and summarize the hit rates")
+	flag.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: %s [flags] <config-file> [trace-file...]\n", os.Args[0])
+		flag.PrintDefaults()
+	}
+	flag.Parse()
 
-	// Initialize the cache configuration and the cache simulator
-	config := cache.InitializeConfig(configFile)
-	cache.InitializeCaches(&config)
+	if flag.NArg() < 1 || (!*checkConfig && flag.NArg() < 2) {
+		flag.Usage()
+		os.Exit(2)
+	}
+	if *comparePLRU && *seeds > 0 {
+		fmt.Fprintln(os.Stderr, "-compare-plru and -seeds can't be used together")
+		flag.Usage()
+		os.Exit(2)
+	}
+	configFile := flag.Arg(0)
+
+	// Load and validate the cache configuration before anything runs
+	config, err := cache.LoadConfig(configFile)
+	if err != nil {
+		exit(err)
+	}
+	if errs := config.Validate(); len(errs) > 0 {
+		exit(cache.ConfigErrors(errs))
+	}
+	if *checkConfig {
+		fmt.Printf("%s: configuration is valid\n", configFile)
+		return
+	}
+
+	// A multi-core configuration takes one trace file holding the accesses
+	// of every core, or one trace file per core
+	traceFiles := flag.Args()[1:]
+
+	// Run the trace with every PLRU policy and LRU, and compare them
+	if *comparePLRU {
+		comparison, err := instruction.ComparePolicies(
+			config, traceFiles, instruction.PLRUPolicies, instruction.PLRUBaseline,
+		)
+		if err != nil {
+			exit(err)
+		}
+		cache.PrintJSON(comparison)
+		return
+	}
+
+	// Run the trace with several seeds, and summarize the hit rates
+	if *seeds > 0 {
+		summary, err := instruction.CompareSeeds(config, traceFiles, *seeds)
+		if err != nil {
+			exit(err)
+		}
+		cache.PrintJSON(summary)
+		return
+	}
+
+	// Initialize the caches and the cache simulator
+	if errs := cache.InitializeCaches(&config); len(errs) > 0 {
+		exit(cache.ConfigErrors(errs))
+	}
 	simulator := instruction.NewCacheSimulator(&config)
 
 	// Execute the cache simulator
-	simulator.Execute(traceFile)
+	if err := simulator.Execute(traceFiles...); err != nil {
+		exit(err)
+	}
+}
+
+// exit reports the given error and exits with status 1
+func exit(err error) {
+	fmt.Fprintln(os.Stderr, err)
+	os.Exit(1)
 }
@@ -0,0 +1,80 @@
+package main
+
+// This file contains the tests of the command line of the cache simulator
+
+import (
+	"errors"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// runMain runs the simulator in a new process with the given arguments,
+// and returns its output and exit status
+func runMain(t *testing.T, args ...string) (string, string, int) {
+	t.Helper()
+	cmd := exec.Command(os.Args[0], append([]string{"-test.run=TestMainProcess", "--"}, args...)...)
+	cmd.Env = append(os.Environ(), "CACHE_SIMULATOR_MAIN=1")
+	var stdout, stderr strings.Builder
+	cmd.Stdout, cmd.Stderr = &stdout, &stderr
+
+	err := cmd.Run()
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) {
+		return stdout.String(), stderr.String(), exitErr.ExitCode()
+	} else if err != nil {
+		t.Fatal(err)
+	}
+	return stdout.String(), stderr.String(), 0
+}
+
+// TestMainProcess runs the main function when started by runMain, with the
+// arguments following "--"
+func TestMainProcess(t *testing.T) {
+	if os.Getenv("CACHE_SIMULATOR_MAIN") != "1" {
+		return
+	}
+	for i, arg := range os.Args {
+		if arg == "--" {
+			os.Args = append([]string{os.Args[0]}, os.Args[i+1:]...)
+			break
+		}
+	}
+	main()
+	os.Exit(0)
+}
+
+// TestCheckConfig checks that --check-config exits with status 0 for a
+// valid config and with status 1 and every error for an invalid one
+func TestCheckConfig(t *testing.T) {
+	valid := filepath.Join("sample-inputs", "direct.json")
+	stdout, _, status := runMain(t, "--check-config", valid)
+	if status != 0 || stdout != valid+": configuration is valid\n" {
+		t.Errorf("--check-config %s exited with status %d and printed %q", valid, status, stdout)
+	}
+
+	invalid := filepath.Join(t.TempDir(), "invalid.json")
+	config := `{"caches": [{"name": "L1", "size": 260, "line_size": 64, "kind": "direct", "write_policy": "write-around"}]}`
+	if err := os.WriteFile(invalid, []byte(config), 0644); err != nil {
+		t.Fatal(err)
+	}
+	want := "caches[0].size (cache \"L1\"): must be a multiple of line_size (64), got 260\n" +
+		"caches[0].write_policy (cache \"L1\"): unknown policy \"write-around\", expected write-back or write-through\n"
+	stdout, stderr, status := runMain(t, "--check-config", invalid)
+	if status != 1 || stdout != "" || stderr != want {
+		t.Errorf("--check-config %s exited with status %d, printed %q and reported\n%s\nwant status 1 and\n%s",
+			invalid, status, stdout, stderr, want)
+	}
+}
+
+// TestCompareFlags checks that the PLRU comparison can't be combined with
+// the seed comparison
+func TestCompareFlags(t *testing.T) {
+	config := filepath.Join("sample-inputs", "full_lru.json")
+	_, stderr, status := runMain(t, "--compare-plru", "--seeds", "2", config, "trace")
+	if status != 2 || !strings.HasPrefix(stderr, "-compare-plru and -seeds can't be used together\n") {
+		t.Errorf("exited with status %d and reported %q, want status 2", status, stderr)
+	}
+}
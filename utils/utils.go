@@ -3,7 +3,10 @@ package utils
 // This file contains utility functions that are used in the cache simulator
 // These function are used for various purposes, such as converting between
 // different representations of numbers (binary, hex, int), and extracting
-// information from memory addresses
+// information from memory addresses. The simulator decodes every address
+// once into a uint64 and extracts the tag, index and offset with shifts and
+// masks. The functions working on 64 character binary strings are kept for
+// compatibility, but allocate several strings per call and are much slower.
 
 import (
 	"fmt"
@@ -19,17 +22,17 @@ func Check(e error) {
 
 // ConvertBinaryToHex converts a hex string to a binary string
 func ConvertHexToBinary(hex string) string {
-	val, err := strconv.ParseInt(hex, 16, 64)
+	val, err := strconv.ParseUint(hex, 16, 64)
 	Check(err)
-	binaryStr := strconv.FormatInt(val, 2)
+	binaryStr := strconv.FormatUint(val, 2)
 	return fmt.Sprintf("%064s", binaryStr)
 }
 
-// ConvertHexToInt converts a hex string to an int
-func ConvertHexToInt(hex string) int {
-	val, err := strconv.ParseInt(hex, 16, 64)
+// ConvertHexToInt converts a hex string to an unsigned 64-bit int
+func ConvertHexToInt(hex string) uint64 {
+	val, err := strconv.ParseUint(hex, 16, 64)
 	Check(err)
-	return int(val)
+	return val
 }
 
 // ConvertStringToRune converts a string to a rune
@@ -44,7 +47,7 @@ func ConvertStringToInt(str string) int {
 	return int(val)
 }
 
-// ConvertBinaryToInt converts a binary string to an int
+// ConvertBinaryToInt converts a binary string of up to 63 bits to an int
 func ConvertBinaryToInt(binary string) int {
 	val, err := strconv.ParseInt(binary, 2, 64)
 	Check(err)
@@ -64,19 +67,43 @@ func ConvertIntToHex(val int) string {
 
 // ConvertHexToBinary converts a hex string to a binary string
 func ConvertBinaryToHex(binary string) string {
-	val, err := strconv.ParseInt(binary, 2, 64)
+	val, err := strconv.ParseUint(binary, 2, 64)
 	Check(err)
 	return fmt.Sprintf("%x", val)
 }
 
-// GetMemoryInfo extracts the index, tag, and offset from a memory address
-func GetMemoryInfo(tagSize int, indexSize int, kind string, address string) (int, int, int) {
+// ParseHexAddress converts a hex memory address to its numeric value
+func ParseHexAddress(hex string) uint64 {
+	val, err := strconv.ParseUint(hex, 16, 64)
+	Check(err)
+	return val
+}
+
+// DecodeAddress extracts the index, tag, and offset from a memory address
+// The offset is held in the lowest offsetSize bits, followed by the index
+// in the next indexSize bits, and the tag in the remaining bits
+func DecodeAddress(address uint64, indexSize int, offsetSize int) (uint64, uint64, uint64) {
+	offset := address & (1<<offsetSize - 1)
+	index := (address >> offsetSize) & (1<<indexSize - 1)
+	tag := address >> (offsetSize + indexSize)
+	return index, tag, offset
+}
+
+// EncodeAddress rebuilds the address of the first byte of the line with
+// the given tag and index
+func EncodeAddress(tag uint64, index uint64, indexSize int, offsetSize int) uint64 {
+	return tag<<(offsetSize+indexSize) | index<<offsetSize
+}
+
+// GetMemoryInfo extracts the index, tag, and offset from a binary memory
+// address string. DecodeAddress should be preferred for numeric addresses.
+func GetMemoryInfo(tagSize int, indexSize int, address string) (int, int, int) {
 	tagBin := address[:tagSize]
 	var index int
 	var tag int
 
-	if kind == "full" {
-		// If the cache is fully associative, the index is always 0
+	if indexSize == 0 {
+		// If the cache has a single set, the index is always 0
 		index = 0
 	} else {
 		indexBin := address[tagSize : tagSize+indexSize]
@@ -90,8 +117,8 @@ func GetMemoryInfo(tagSize int, indexSize int, kind string, address string) (int
 }
 
 // GetIndex extracts the index from a memory address
-func GetIndex(indexSize int, tagSize int, kind string, address string) int {
-	if kind == "full" {
+func GetIndex(indexSize int, tagSize int, address string) int {
+	if indexSize == 0 {
 		return 0
 	}
 
@@ -0,0 +1,55 @@
+package utils
+
+// This file contains benchmarks comparing the decoding of memory addresses
+// through 64 character binary strings with the decoding through uint64 bit
+// arithmetic. Run them with `go test -bench . ./utils`.
+
+import "testing"
+
+// Addresses taken from the sample traces
+var benchAddresses = []string{
+	"7ffd0e62", "14000440", "7ffd00e8", "20abcdef", "400068", "7fff5fbff8a0",
+}
+
+// The geometry of a 32KB 8-way cache with 64 byte lines
+const (
+	benchTagSize    = 52
+	benchIndexSize  = 6
+	benchOffsetSize = 6
+)
+
+var sinkIndex, sinkTag, sinkOffset int
+var sinkIndex64, sinkTag64, sinkOffset64 uint64
+
+// BenchmarkBinaryStringDecode measures the previous path, where each
+// address is converted to a binary string and sliced into its fields
+func BenchmarkBinaryStringDecode(b *testing.B) {
+	for i := 0; i < b.N; i++ {
+		address := ConvertHexToBinary(benchAddresses[i%len(benchAddresses)])
+		sinkIndex, sinkTag, sinkOffset = GetMemoryInfo(benchTagSize, benchIndexSize, address)
+	}
+}
+
+// BenchmarkUint64Decode measures the current path, where each address is
+// parsed once and its fields are extracted with shifts and masks
+func BenchmarkUint64Decode(b *testing.B) {
+	for i := 0; i < b.N; i++ {
+		address := ParseHexAddress(benchAddresses[i%len(benchAddresses)])
+		sinkIndex64, sinkTag64, sinkOffset64 = DecodeAddress(address, benchIndexSize, benchOffsetSize)
+	}
+}
+
+// BenchmarkUint64DecodeOnly measures the extraction of the fields from an
+// already parsed address, which is done once per cache level
+func BenchmarkUint64DecodeOnly(b *testing.B) {
+	addresses := make([]uint64, len(benchAddresses))
+	for i, hex := range benchAddresses {
+		addresses[i] = ParseHexAddress(hex)
+	}
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		address := addresses[i%len(addresses)]
+		sinkIndex64, sinkTag64, sinkOffset64 = DecodeAddress(address, benchIndexSize, benchOffsetSize)
+	}
+}